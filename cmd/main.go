@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	// "github.com/gorilla/mux"
@@ -32,7 +33,7 @@ func main() {
 	// Debemos definir el Context para pasarselo al handler
 	ctx := context.Background()
 
-	userRepository := user.NewRepo(l, db) // Importamos el Logger (l)
+	userRepository := user.NewRepo(l, db, os.Getenv("PHONE_DEFAULT_REGION")) // Importamos el Logger (l)
 
 	// Al haber hecho lo de la capa de servicio. Va a necesitar recibir un servicio, nosotros debemos especificarlo
 	userService := user.NewService(l, userRepository) // Este userService se lo debemos pasar al endpoint. En este caso, le pasamos el repository // Importamos el Logger (l)
@@ -40,7 +41,58 @@ func main() {
 	 */
 
 	// Generamos el handler. Que sera la funcion de NewUserHTTPServer
-	handler := handler.NewUserHTTPServer(ctx, user.MakeEndpoints(userService, user.Config{LimPageDef: pagLimDef}))
+	// Con USER_PUT_UPSERT=true el PUT crea el usuario si no existe
+	// Con USER_REQUIRE_IF_MATCH=true las modificaciones exigen el header If-Match
+	// PHONE_DEFAULT_REGION es el pais de los telefonos sin codigo de pais (por defecto AR)
+	config := user.Config{
+		LimPageDef:     pagLimDef,
+		AllowUpsert:    os.Getenv("USER_PUT_UPSERT") == "true",
+		RequireIfMatch: os.Getenv("USER_REQUIRE_IF_MATCH") == "true",
+		PhoneRegion:    os.Getenv("PHONE_DEFAULT_REGION"),
+	}
+
+	// IDEMPOTENCY_TTL es cuanto se guardan las respuestas de los requests con Idempotency-Key (ej: 24h)
+	idempotencyTTL := 24 * time.Hour
+	if v := os.Getenv("IDEMPOTENCY_TTL"); v != "" {
+		idempotencyTTL, err = time.ParseDuration(v)
+		if err != nil {
+			l.Fatal("invalid IDEMPOTENCY_TTL: ", err)
+		}
+	}
+
+	// IDEMPOTENCY_MAX_KEYS es la cantidad maxima de keys guardadas en memoria (por defecto 10000).
+	// Como estan en memoria solo sirven con una instancia del servicio
+	var idempotencyMaxKeys int
+	if v := os.Getenv("IDEMPOTENCY_MAX_KEYS"); v != "" {
+		idempotencyMaxKeys, err = strconv.Atoi(v)
+		if err != nil {
+			l.Fatal("invalid IDEMPOTENCY_MAX_KEYS: ", err)
+		}
+	}
+
+	// MAX_BODY_SIZE es el tamaño maximo de los bodies JSON en bytes (por defecto 1MB)
+	var maxBodySize int64
+	if v := os.Getenv("MAX_BODY_SIZE"); v != "" {
+		maxBodySize, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			l.Fatal("invalid MAX_BODY_SIZE: ", err)
+		}
+	}
+
+	// Con ERRORS_PROBLEM_JSON=true los errores siempre salen como problem+json (RFC 7807), si no solo cuando el cliente lo pide
+	// Con JSON_DISALLOW_UNKNOWN_FIELDS=true los bodies con campos que no existen devuelven 400
+	handlerConfig := handler.Config{
+		IdempotencyTTL:     idempotencyTTL,
+		IdempotencyMaxKeys: idempotencyMaxKeys,
+		ProblemJSON:        os.Getenv("ERRORS_PROBLEM_JSON") == "true",
+		ProblemTypeBase:    os.Getenv("PROBLEM_TYPE_BASE"),
+		DefaultLanguage:    os.Getenv("ERRORS_DEFAULT_LANGUAGE"),
+
+		MaxBodySize:           maxBodySize,
+		DisallowUnknownFields: os.Getenv("JSON_DISALLOW_UNKNOWN_FIELDS") == "true",
+	}
+
+	handler := handler.NewUserHTTPServer(ctx, l, user.MakeEndpoints(userService, config), handlerConfig)
 
 	/* 	router.HandleFunc("/users", userEndpoint.GetAll).Methods("GET")
 	   	router.HandleFunc("/users/{id}", userEndpoint.Get).Methods("GET") // La rutas dinamicas se usan con /{"Nombre de lo que deseamos dinamico"}
@@ -82,8 +134,9 @@ func main() {
 func accessControl(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS, HEAD")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept,Authorization,Cache-Control,Content-Type,DNT,If-Modified-Since,Keep-Alive,Origin,User-Agent,X-Requested-With")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS, HEAD")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept,Authorization,Cache-Control,Content-Type,DNT,Idempotency-Key,If-Match,If-Modified-Since,If-None-Match,Keep-Alive,Origin,User-Agent,X-Request-ID,X-Requested-With")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag,Idempotent-Replayed,Last-Modified,Link,X-Request-ID,X-Total-Count")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusNoContent)
@@ -6,6 +6,8 @@ require (
 	github.com/gorilla/mux v1.8.1
 	github.com/juanjoaquin/back-g-domain v0.0.1
 	github.com/juanjoaquin/back-g-meta v0.0.0-20251228234920-84530c134b90
+	github.com/juanjoaquin/back-g-response v0.0.1
+	github.com/nyaruka/phonenumbers v1.5.0
 	gorm.io/driver/mysql v1.6.0
 	gorm.io/gorm v1.31.1
 )
@@ -13,16 +15,17 @@ require (
 require (
 	github.com/go-kit/log v0.2.0 // indirect
 	github.com/go-logfmt/logfmt v0.5.1 // indirect
-	github.com/juanjoaquin/back-g-response v0.0.1 // indirect
+	golang.org/x/exp v0.0.0-20240525044651-4c93da0ed11d // indirect
+	google.golang.org/protobuf v1.34.1 // indirect
 )
 
 require (
 	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/go-kit/kit v0.13.0
-	github.com/go-sql-driver/mysql v1.8.1 // indirect
-	github.com/google/uuid v1.6.0 // indirect
+	github.com/go-sql-driver/mysql v1.8.1
+	github.com/google/uuid v1.6.0
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/joho/godotenv v1.5.1
-	golang.org/x/text v0.20.0 // indirect
+	golang.org/x/text v0.20.0
 )
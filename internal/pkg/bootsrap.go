@@ -6,7 +6,7 @@ import (
 	"log"
 	"os"
 
-	"github.com/juanjoaquin/back-g-domain/domain" // Hay que hacer un go get con el link del repo
+	"github.com/juanjoaquin/back-g-user/internal/user"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
@@ -24,7 +24,8 @@ func DBConnection() (*gorm.DB, error) {
 	/* Para la conexion a la DB, debemos usar el gorm package
 	Con la funcion Open, y el package mysql
 	*/
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	// Con TranslateError GORM convierte los errores de MySQL en los de GORM (ej: 1062 => gorm.ErrDuplicatedKey)
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{TranslateError: true})
 
 	if err != nil {
 		return nil, err
@@ -37,8 +38,9 @@ func DBConnection() (*gorm.DB, error) {
 	}
 
 	// Debemos hacer el Auto Migrate a traves de las variables de entorno
+	// El Migrate del package user agrega las columnas propias del servicio sobre el domain.User
 	if os.Getenv("DATABASE_MIGRATE") == "true" {
-		if err := db.AutoMigrate(&domain.User{}); err != nil {
+		if err := user.Migrate(db, os.Getenv("PHONE_DEFAULT_REGION")); err != nil {
 			return nil, err
 		}
 	}
@@ -0,0 +1,91 @@
+package handler
+
+// Cache HTTP de los GET: mandamos ETag, Last-Modified (solo en el GET de un usuario) y Cache-Control,
+// y si el cliente ya tiene la misma version (If-None-Match / If-Modified-Since) respondemos 304 sin body.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juanjoaquin/back-g-response/response"
+	"github.com/juanjoaquin/back-g-user/internal/user"
+)
+
+// El cliente puede guardar la respuesta pero siempre tiene que revalidarla
+const cacheControl = "private, no-cache"
+
+// Seteamos los headers de cache. Devuelve true si hay que responder 304 Not Modified
+func setCacheHeaders(ctx context.Context, w http.ResponseWriter, resp response.Response, body []byte) bool {
+	sr, ok := resp.(*response.SuccessResponse)
+	if !ok {
+		return false
+	}
+
+	etag, lastModified := validators(sr.Data)
+
+	// En las escrituras solo mandamos el ETag del usuario (para el If-Match), el resto es para los GET
+	r := requestFromContext(ctx)
+	if r == nil || r.Method != http.MethodGet || sr.StatusCode() != http.StatusOK {
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		return false
+	}
+
+	// Si no es un usuario (listados, campos parciales), el ETag sale del body
+	if etag == "" {
+		etag = bodyETag(body)
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	if lastModified != nil {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	return notModified(r, etag, lastModified)
+}
+
+// ETag y fecha de ultima modificacion segun lo que devuelve el endpoint. Los listados no llevan Last-Modified:
+// si se borra un usuario no cambia el updated_at de ningun otro y el If-Modified-Since daria un 304 viejo.
+// Para ellos alcanza con el ETag del body
+func validators(data interface{}) (string, *time.Time) {
+	if d, ok := data.(*user.User); ok {
+		return user.ETag(&d.User), d.UpdatedAt
+	}
+	return "", nil
+}
+
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// El If-None-Match tiene prioridad. El If-Modified-Since solo se usa si no vino el If-None-Match
+func notModified(r *http.Request, etag string, lastModified *time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			// Para el GET la comparacion es debil, ignoramos el W/
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && lastModified != nil {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		// El header tiene precision de segundos
+		return !lastModified.Truncate(time.Second).After(t)
+	}
+
+	return false
+}
@@ -0,0 +1,181 @@
+package handler
+
+// Decode de los bodies y query params, compartido por todos los decoders. El body tiene que venir con el
+// Content-Type correcto, no pasarse del tamaño maximo y tener un solo valor JSON. Con DisallowUnknownFields
+// tambien rechazamos los campos que no conocemos (ej: un typo en first_name)
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	defaultMaxBodySize = 1 << 20  // 1MB, sobra para cualquier body JSON de la API
+	maxImportSize      = 20 << 20 // El CSV del import puede ser bastante mas grande
+)
+
+// El server tiene ReadTimeout y WriteTimeout de 5s. El import y el alta masiva pueden tardar bastante mas
+// (subir 20MB, miles de INSERT), asi que a esas rutas les extendemos los deadlines igual que en el export
+const longRequestTimeout = 2 * time.Minute
+
+const (
+	jsonContentType       = "application/json"
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+	multipartContentType  = "multipart/form-data"
+)
+
+// Content-Types del CSV del import. Excel y algunos navegadores lo mandan como text/plain o vnd.ms-excel
+var csvContentTypes = []string{"text/csv", "application/csv", "text/plain", "application/vnd.ms-excel", multipartContentType}
+
+const decodeOptionsKey contextKey = "decode-options"
+
+type decodeOptions struct {
+	maxBodySize           int64
+	disallowUnknownFields bool
+}
+
+// Guardamos la config del decode en el Context, igual que el Request, asi los decoders de Go Kit la pueden usar
+func withDecodeOptions(config Config) httptransport.RequestFunc {
+	opts := decodeOptions{
+		maxBodySize:           maxBodySize(config),
+		disallowUnknownFields: config.DisallowUnknownFields,
+	}
+
+	return func(ctx context.Context, _ *http.Request) context.Context {
+		return context.WithValue(ctx, decodeOptionsKey, opts)
+	}
+}
+
+func maxBodySize(config Config) int64 {
+	if config.MaxBodySize <= 0 {
+		return defaultMaxBodySize
+	}
+	return config.MaxBodySize
+}
+
+func decodeOptionsFromContext(ctx context.Context) decodeOptions {
+	opts, ok := ctx.Value(decodeOptionsKey).(decodeOptions)
+	if !ok {
+		opts.maxBodySize = defaultMaxBodySize
+	}
+	return opts
+}
+
+// Decodifica el body en v. Si no se pasan mediaTypes solo se acepta application/json
+func decodeJSON(ctx context.Context, r *http.Request, v interface{}, mediaTypes ...string) error {
+	if err := checkContentType(r, mediaTypes...); err != nil {
+		return err
+	}
+
+	opts := decodeOptionsFromContext(ctx)
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, opts.maxBodySize))
+	if opts.disallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+
+	if err := dec.Decode(v); err != nil {
+		return bodyError(err)
+	}
+
+	// Despues del valor no puede venir nada mas (ej: {"a":1}{"b":2})
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return bodyError(err)
+		}
+		return decodeError(codeTrailingData)
+	}
+
+	return nil
+}
+
+func checkContentType(r *http.Request, mediaTypes ...string) error {
+	if len(mediaTypes) == 0 {
+		mediaTypes = []string{jsonContentType}
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		for _, accepted := range mediaTypes {
+			if mediaType == accepted {
+				return nil
+			}
+		}
+	}
+
+	return newError(codeUnsupportedMediaType, http.StatusUnsupportedMediaType, "content_type", contentType, "accepted", strings.Join(mediaTypes, ", "))
+}
+
+// Traducimos los errores del encoding/json a errores con codigo
+func bodyError(err error) error {
+	var (
+		tooLarge  *http.MaxBytesError
+		typeError *json.UnmarshalTypeError
+	)
+
+	switch {
+	case errors.As(err, &tooLarge):
+		return newError(codeRequestTooLarge, http.StatusRequestEntityTooLarge, "max", strconv.FormatInt(tooLarge.Limit, 10))
+	case errors.Is(err, io.EOF):
+		return decodeError(codeEmptyBody)
+	case errors.As(err, &typeError) && typeError.Field != "":
+		return decodeError(codeInvalidFieldValue, "field", typeError.Field)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json no tiene un tipo para este error, solo el mensaje
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		return decodeError(codeUnknownField, "field", field)
+	}
+
+	return decodeError(codeInvalidFormat, "error", err.Error())
+}
+
+func extendDeadlines(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Si el ResponseWriter no soporta deadlines (ej: en tests) seguimos igual
+		rc := http.NewResponseController(w)
+		deadline := time.Now().Add(timeout)
+		_ = rc.SetReadDeadline(deadline)
+		_ = rc.SetWriteDeadline(deadline)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Query params numericos. Si no vienen devolvemos 0 y el endpoint usa el valor por defecto
+func parseIntParam(v url.Values, name string) (int, error) {
+	value := v.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, decodeError(codeInvalidParameter, "param", name, "value", value)
+	}
+	return n, nil
+}
+
+func parseBoolParam(v url.Values, name string) (bool, error) {
+	value := v.Get(name)
+	if value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, decodeError(codeInvalidParameter, "param", name, "value", value)
+	}
+	return b, nil
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	type body struct {
+		FirstName string `json:"first_name"`
+		Age       int    `json:"age"`
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		mediaTypes  []string
+		opts        decodeOptions
+		want        body
+		status      int    // 0 = sin error
+		code        string // Codigo del error
+		field       string // Param field del error, si corresponde
+	}{
+		{name: "ok", contentType: "application/json", body: `{"first_name":"Juan","age":30}`, want: body{FirstName: "Juan", Age: 30}},
+		{name: "con charset", contentType: "application/json; charset=utf-8", body: `{"first_name":"Juan"}`, want: body{FirstName: "Juan"}},
+		{name: "espacios al final", contentType: "application/json", body: "{\"first_name\":\"Juan\"}\n  \n", want: body{FirstName: "Juan"}},
+		{name: "dos valores", contentType: "application/json", body: `{"first_name":"Juan"}{"first_name":"Pedro"}`, status: http.StatusBadRequest, code: codeTrailingData},
+		{name: "basura al final", contentType: "application/json", body: `{"first_name":"Juan"} x`, status: http.StatusBadRequest, code: codeTrailingData},
+		{name: "body vacio", contentType: "application/json", body: ``, status: http.StatusBadRequest, code: codeEmptyBody},
+		{name: "JSON invalido", contentType: "application/json", body: `{"first_name":`, status: http.StatusBadRequest, code: codeInvalidFormat},
+		{name: "tipo invalido", contentType: "application/json", body: `{"age":"treinta"}`, status: http.StatusBadRequest, code: codeInvalidFieldValue, field: "age"},
+		{name: "campo desconocido permitido", contentType: "application/json", body: `{"first_name":"Juan","nickname":"J"}`, want: body{FirstName: "Juan"}},
+		{
+			name:        "campo desconocido rechazado",
+			contentType: "application/json",
+			body:        `{"first_name":"Juan","nickname":"J"}`,
+			opts:        decodeOptions{disallowUnknownFields: true},
+			status:      http.StatusBadRequest,
+			code:        codeUnknownField,
+			field:       "nickname",
+		},
+		{
+			name:        "body muy grande",
+			contentType: "application/json",
+			body:        `{"first_name":"` + strings.Repeat("a", 64) + `"}`,
+			opts:        decodeOptions{maxBodySize: 32},
+			status:      http.StatusRequestEntityTooLarge,
+			code:        codeRequestTooLarge,
+		},
+		{
+			name:        "se pasa del limite despues del valor",
+			contentType: "application/json",
+			body:        `{"first_name":"Juan"}` + strings.Repeat(" ", 64) + `{}`,
+			opts:        decodeOptions{maxBodySize: 32},
+			status:      http.StatusRequestEntityTooLarge,
+			code:        codeRequestTooLarge,
+		},
+		{name: "sin Content-Type", contentType: "", body: `{"first_name":"Juan"}`, status: http.StatusUnsupportedMediaType, code: codeUnsupportedMediaType},
+		{name: "otro Content-Type", contentType: "text/plain", body: `{"first_name":"Juan"}`, status: http.StatusUnsupportedMediaType, code: codeUnsupportedMediaType},
+		{name: "Content-Type invalido", contentType: "application/", body: `{"first_name":"Juan"}`, status: http.StatusUnsupportedMediaType, code: codeUnsupportedMediaType},
+		{
+			name:        "merge patch aceptado",
+			contentType: mergePatchContentType,
+			body:        `{"first_name":"Juan"}`,
+			mediaTypes:  []string{jsonContentType, mergePatchContentType},
+			want:        body{FirstName: "Juan"},
+		},
+		{
+			name:        "merge patch no aceptado",
+			contentType: mergePatchContentType,
+			body:        `{"first_name":"Juan"}`,
+			status:      http.StatusUnsupportedMediaType,
+			code:        codeUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+
+			opts := tt.opts
+			if opts.maxBodySize == 0 {
+				opts.maxBodySize = defaultMaxBodySize
+			}
+			ctx := context.WithValue(context.Background(), decodeOptionsKey, opts)
+
+			var got body
+			err := decodeJSON(ctx, r, &got, tt.mediaTypes...)
+
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("decoded = %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("expected error %s, got nil", tt.code)
+			}
+			resp := toErrorResponse(err)
+			if resp.Status != tt.status || resp.Code != tt.code {
+				t.Errorf("error = %d %s, want %d %s (%v)", resp.Status, resp.Code, tt.status, tt.code, err)
+			}
+			if tt.field != "" && resp.Params["field"] != tt.field {
+				t.Errorf("field = %q, want %q", resp.Params["field"], tt.field)
+			}
+		})
+	}
+}
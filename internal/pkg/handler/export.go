@@ -0,0 +1,196 @@
+package handler
+
+// Export de usuarios en CSV o NDJSON. Vamos escribiendo cada lote que trae el repositorio,
+// asi no cargamos toda la tabla en memoria y el cliente empieza a recibir datos enseguida.
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/juanjoaquin/back-g-user/internal/user"
+)
+
+// El server tiene un WriteTimeout corto, lo vamos extendiendo en cada lote que escribimos
+const exportWriteTimeout = 30 * time.Second
+
+var csvHeader = []string{"id", "first_name", "last_name", "email", "phone", "phone_display", "created_at", "updated_at"}
+
+func decodeExportUsers(_ context.Context, r *http.Request) (interface{}, error) {
+	v := r.URL.Query()
+
+	filters, err := decodeFilters(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.ExportReq{
+		Format:  v.Get("format"),
+		Filters: filters,
+	}, nil
+}
+
+// Los dos formatos llevan las mismas columnas. En el NDJSON no usamos user.User porque no serializa las fechas
+type exportRow struct {
+	ID           string `json:"id"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	Email        string `json:"email"`
+	Phone        string `json:"phone"`
+	PhoneDisplay string `json:"phone_display"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+func newExportRow(u user.User) exportRow {
+	return exportRow{
+		ID:           u.ID,
+		FirstName:    u.FirstName,
+		LastName:     u.LastName,
+		Email:        u.Email,
+		Phone:        u.Phone,
+		PhoneDisplay: u.PhoneDisplay,
+		CreatedAt:    formatTime(u.CreatedAt),
+		UpdatedAt:    formatTime(u.UpdatedAt),
+	}
+}
+
+func (row exportRow) csv() []string {
+	return []string{
+		csvCell(row.ID), csvCell(row.FirstName), csvCell(row.LastName), csvCell(row.Email), csvCell(row.Phone), csvCell(row.PhoneDisplay), row.CreatedAt, row.UpdatedAt,
+	}
+}
+
+// Necesitamos el logger para los errores que pasan con la respuesta ya empezada, que no le podemos devolver al cliente
+func newExportEncoder(log *log.Logger) httptransport.EncodeResponseFunc {
+	return func(ctx context.Context, w http.ResponseWriter, resp interface{}) error {
+		return encodeExport(ctx, log, w, resp)
+	}
+}
+
+func encodeExport(ctx context.Context, log *log.Logger, w http.ResponseWriter, resp interface{}) error {
+	export, ok := resp.(user.Export)
+	if !ok {
+		return fmt.Errorf("unexpected response type %T", resp)
+	}
+	rc := http.NewResponseController(w)
+
+	started := false
+	var csvWriter *csv.Writer
+	var jsonEncoder *json.Encoder
+
+	// Los headers los escribimos con el primer lote, asi si falla la primer consulta todavia podemos devolver un error
+	start := func() {
+		started = true
+		if export.Format == user.ExportCSV {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="users.csv"`)
+			w.WriteHeader(http.StatusOK)
+			csvWriter = csv.NewWriter(w)
+			_ = csvWriter.Write(csvHeader)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="users.ndjson"`)
+		w.WriteHeader(http.StatusOK)
+		jsonEncoder = json.NewEncoder(w)
+	}
+
+	err := export.Each(func(users []user.User) error {
+		// Si el ResponseWriter no soporta deadlines (ej: en tests) seguimos igual
+		_ = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+
+		if !started {
+			start()
+		}
+
+		for _, u := range users {
+			if err := writeExportRow(csvWriter, jsonEncoder, u); err != nil {
+				return err
+			}
+		}
+
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+		_ = rc.Flush()
+		return nil
+	})
+
+	if err != nil && !started {
+		return user.NewErrorResponse(err, user.ErrorStatus(err))
+	}
+
+	// Sin usuarios igual devolvemos el archivo (en el CSV solo el header)
+	if !started {
+		start()
+		if csvWriter != nil {
+			csvWriter.Flush()
+		}
+	}
+
+	// Si fallo en el medio ya mandamos el status 200, lo unico que podemos hacer es cortar la conexion.
+	// Asi el cliente recibe un error de red y no un archivo incompleto que parece terminado
+	if err != nil {
+		log.Println("[ERROR]-[HANDLER]-[EXPORT]", requestIDFromContext(ctx), err)
+		panic(http.ErrAbortHandler)
+	}
+
+	return nil
+}
+
+func writeExportRow(csvWriter *csv.Writer, jsonEncoder *json.Encoder, u user.User) error {
+	row := newExportRow(u)
+	if jsonEncoder != nil {
+		return jsonEncoder.Encode(row)
+	}
+
+	return csvWriter.Write(row.csv())
+}
+
+// Excel ejecuta como formula las celdas que empiezan con estos caracteres (ej: =HYPERLINK(...)).
+// Les agregamos una comilla adelante para que se vean como texto. Un + o - seguido solo de digitos es un numero
+// (ej: el telefono en E.164), no una formula, y lo dejamos igual que en el NDJSON
+func csvCell(value string) string {
+	if value == "" {
+		return value
+	}
+
+	switch value[0] {
+	case '+', '-':
+		if isDigits(value[1:]) {
+			return value
+		}
+		return "'" + value
+	case '=', '@', '\t', '\r':
+		return "'" + value
+	}
+	return value
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juanjoaquin/back-g-domain/domain"
+	"github.com/juanjoaquin/back-g-user/internal/user"
+)
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"Juan", "Juan"},
+		{"+541144445555", "+541144445555"},
+		{"-15", "-15"},
+		{"+54 11 4444-5555", "'+54 11 4444-5555"},
+		{"+", "'+"},
+		{"-1+1", "'-1+1"},
+		{"+SUM(A1:A2)", "'+SUM(A1:A2)"},
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"@SUM(1)", "'@SUM(1)"},
+		{"\tjuan", "'\tjuan"},
+		{"\rjuan", "'\rjuan"},
+		{"juan=1", "juan=1"},
+	}
+
+	for _, tt := range tests {
+		if got := csvCell(tt.value); got != tt.want {
+			t.Errorf("csvCell(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeExport(t *testing.T) {
+	created := time.Date(2024, 5, 10, 12, 30, 0, 0, time.UTC)
+	users := []user.User{
+		{User: domain.User{ID: "1", FirstName: "Juan", LastName: "Perez", Email: "juan@mail.com", Phone: "+541144445555", CreatedAt: &created, UpdatedAt: &created}, PhoneDisplay: "011 4444-5555"},
+		{User: domain.User{ID: "2", FirstName: "=cmd()", LastName: "Gomez", CreatedAt: &created, UpdatedAt: &created}},
+	}
+	each := func(fn func([]user.User) error) error {
+		return fn(users)
+	}
+
+	// Las dos salidas tienen que tener las mismas columnas con los mismos valores, salvo las formulas neutralizadas
+	want := [][]string{
+		{"1", "Juan", "Perez", "juan@mail.com", "+541144445555", "011 4444-5555", "2024-05-10T12:30:00Z", "2024-05-10T12:30:00Z"},
+		{"2", "=cmd()", "Gomez", "", "", "", "2024-05-10T12:30:00Z", "2024-05-10T12:30:00Z"},
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		if err := encodeExport(context.Background(), discardLog(), w, user.Export{Format: user.ExportCSV, Each: each}); err != nil {
+			t.Fatal(err)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+
+		records, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+			t.Errorf("header = %v, want %v", records[0], csvHeader)
+		}
+		if len(records) != len(want)+1 {
+			t.Fatalf("got %d records, want %d", len(records), len(want)+1)
+		}
+		for i, row := range want {
+			expected := append([]string(nil), row...)
+			expected[1] = csvCell(expected[1])
+			if strings.Join(records[i+1], "|") != strings.Join(expected, "|") {
+				t.Errorf("row %d = %q, want %q", i, records[i+1], expected)
+			}
+		}
+		if records[2][1] != "'=cmd()" {
+			t.Errorf("formula not escaped: %q", records[2][1])
+		}
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		if err := encodeExport(context.Background(), discardLog(), w, user.Export{Format: user.ExportNDJSON, Each: each}); err != nil {
+			t.Fatal(err)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+
+		dec := json.NewDecoder(w.Body)
+		for i, row := range want {
+			var got map[string]string
+			if err := dec.Decode(&got); err != nil {
+				t.Fatalf("row %d: %v", i, err)
+			}
+			if len(got) != len(csvHeader) {
+				t.Errorf("row %d has %d columns, want %d", i, len(got), len(csvHeader))
+			}
+			for j, column := range csvHeader {
+				if got[column] != row[j] {
+					t.Errorf("row %d %s = %q, want %q", i, column, got[column], row[j])
+				}
+			}
+		}
+	})
+
+	t.Run("sin usuarios", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		empty := func(fn func([]user.User) error) error { return nil }
+		if err := encodeExport(context.Background(), discardLog(), w, user.Export{Format: user.ExportCSV, Each: empty}); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(w.Body.String()); got != strings.Join(csvHeader, ",") {
+			t.Errorf("body = %q, want only the header", got)
+		}
+	})
+
+	t.Run("falla antes de empezar", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		fail := func(fn func([]user.User) error) error { return user.ErrUserNotFound{UserID: "x"} }
+		err := encodeExport(context.Background(), discardLog(), w, user.Export{Format: user.ExportCSV, Each: fail})
+
+		var resp *user.ErrorResponse
+		if !errors.As(err, &resp) || resp.Status != http.StatusNotFound {
+			t.Fatalf("err = %v, want a 404 ErrorResponse", err)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("body written: %q", w.Body.String())
+		}
+	})
+
+	t.Run("falla en el medio corta la conexion", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		var logs bytes.Buffer
+		fail := func(fn func([]user.User) error) error {
+			if err := fn(users); err != nil {
+				return err
+			}
+			return errors.New("connection lost")
+		}
+
+		defer func() {
+			if r := recover(); r != http.ErrAbortHandler {
+				t.Fatalf("recover() = %v, want http.ErrAbortHandler", r)
+			}
+			if !strings.Contains(logs.String(), "connection lost") {
+				t.Errorf("error not logged: %q", logs.String())
+			}
+		}()
+		_ = encodeExport(context.Background(), log.New(&logs, "", 0), w, user.Export{Format: user.ExportNDJSON, Each: fail})
+	})
+}
+
+func discardLog() *log.Logger {
+	return log.New(io.Discard, "", 0)
+}
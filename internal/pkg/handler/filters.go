@@ -0,0 +1,93 @@
+package handler
+
+// Aqui armamos los Filters del package user a partir de los query params.
+// Lo usan todos los endpoints que filtran usuarios, asi siempre se interpretan igual.
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/juanjoaquin/back-g-user/internal/user"
+)
+
+const dateLayout = "2006-01-02"
+
+// Query params que entiende decodeFilters. En las operaciones masivas (el filter del body de la modificacion
+// y los query params del borrado) no se aceptan otros
+var filterParams = map[string]bool{
+	"first_name":   true,
+	"last_name":    true,
+	"email":        true,
+	"email_like":   true,
+	"phone":        true,
+	"ids":          true,
+	"q":            true,
+	"created_from": true,
+	"created_to":   true,
+	"updated_from": true,
+	"updated_to":   true,
+}
+
+func decodeFilters(v url.Values) (user.Filters, error) {
+	filters := user.Filters{
+		FirstName: v.Get("first_name"),
+		LastName:  v.Get("last_name"),
+		Email:     v.Get("email"),
+		EmailLike: v.Get("email_like"),
+		Phone:     v.Get("phone"),
+		IDs:       splitList(v.Get("ids")),
+		Search:    v.Get("q"),
+	}
+
+	// Los rangos de fechas aceptan RFC3339 o solo la fecha (YYYY-MM-DD)
+	var err error
+	if filters.CreatedFrom, err = parseDateParam(v, "created_from", false); err != nil {
+		return filters, err
+	}
+	if filters.CreatedTo, err = parseDateParam(v, "created_to", true); err != nil {
+		return filters, err
+	}
+	if filters.UpdatedFrom, err = parseDateParam(v, "updated_from", false); err != nil {
+		return filters, err
+	}
+	if filters.UpdatedTo, err = parseDateParam(v, "updated_to", true); err != nil {
+		return filters, err
+	}
+
+	return filters, nil
+}
+
+// Si el param "to" viene solo con la fecha, incluimos el dia completo
+func parseDateParam(v url.Values, name string, endOfDay bool) (*time.Time, error) {
+	value := v.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.ParseInLocation(dateLayout, value, time.Local)
+	if err != nil {
+		return nil, decodeError(codeInvalidParameter, "param", name, "value", value)
+	}
+
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	return &t, nil
+}
+
+// Separamos una lista por comas (ej: ids=a,b,c) ignorando los vacios
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
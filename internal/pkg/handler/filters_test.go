@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/juanjoaquin/back-g-user/internal/user"
+)
+
+// En las operaciones masivas un filtro desconocido no se puede ignorar: se modificarian o borrarian usuarios de mas
+func TestDecodeBulkFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		want    user.Filters
+		unknown string // Campo del error unknown-field, vacio si no hay error
+	}{
+		{name: "delete por ids", method: http.MethodDelete, target: "/users?ids=a,b", want: user.Filters{IDs: []string{"a", "b"}}},
+		{name: "delete por filtro", method: http.MethodDelete, target: "/users?last_name=Perez&q=juan", want: user.Filters{LastName: "Perez", Search: "juan"}},
+		{name: "delete con typo", method: http.MethodDelete, target: "/users?ids=a&frist_name=nope", unknown: "frist_name"},
+		{name: "delete con typo junto a un filtro", method: http.MethodDelete, target: "/users?last_name=Perez&frist_name=Juan", unknown: "frist_name"},
+		{name: "delete con param que no es filtro", method: http.MethodDelete, target: "/users?ids=a&purge=true", unknown: "purge"},
+		{
+			name:   "patch por filtro",
+			method: http.MethodPatch,
+			target: "/users",
+			body:   `{"ids":["a"],"filter":{"last_name":"Perez"},"first_name":"Juan"}`,
+			want:   user.Filters{LastName: "Perez", IDs: []string{"a"}},
+		},
+		{name: "patch con typo en el filter", method: http.MethodPatch, target: "/users", body: `{"filter":{"emial":"x@mail.com"},"first_name":"Juan"}`, unknown: "filter.emial"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", jsonContentType)
+
+			var req interface{}
+			var err error
+			if tt.method == http.MethodDelete {
+				req, err = decodeBulkDeleteUsers(context.Background(), r)
+			} else {
+				req, err = decodeBulkUpdateUsers(context.Background(), r)
+			}
+
+			if tt.unknown != "" {
+				if err == nil {
+					t.Fatalf("expected unknown-field error, got %+v", req)
+				}
+				resp := toErrorResponse(err)
+				if resp.Code != codeUnknownField || resp.Params["field"] != tt.unknown {
+					t.Errorf("error = %s %v, want %s field=%s", resp.Code, resp.Params, codeUnknownField, tt.unknown)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			var got user.Filters
+			switch req := req.(type) {
+			case user.BulkDeleteReq:
+				got = req.Filters
+			case user.BulkUpdateReq:
+				got = req.Filters
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filters = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package handler
+
+// Soporte del header Idempotency-Key. Si el cliente reintenta un POST (por ejemplo despues de un timeout)
+// con la misma key, devolvemos la respuesta guardada en vez de volver a ejecutar el endpoint.
+// Cada ruta lo habilita envolviendo su handler con wrap.
+// Las keys se guardan en memoria: con varias instancias detras de un balanceador, un reintento que cae en otra
+// instancia se vuelve a ejecutar. Para eso habria que guardarlas en la DB (una tabla con la key, el hash y la respuesta)
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	idempotencyHeader         = "Idempotency-Key"
+	idempotencyReplayed       = "Idempotent-Replayed"
+	maxIdempotencyKey         = 255
+	idempotencySweep          = time.Minute // Cada cuanto limpiamos las keys vencidas
+	defaultIdempotencyMaxKeys = 10000       // Con respuestas de unos pocos KB son decenas de MB como mucho
+)
+
+// Guardamos las keys en memoria. Alcanza con una sola instancia del servicio
+type idempotency struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	maxKeys   int                        // Si se llena, descartamos las respuestas guardadas mas viejas
+	maxBody   int64                      // Leemos el body completo para el hash, con el mismo limite que el decode
+	encode    httptransport.ErrorEncoder // Para devolver los errores en el mismo formato que el resto de las rutas
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+type idempotencyEntry struct {
+	hash    string // Hash del request original, para detectar que se reuso la key con otro body
+	done    bool   // false mientras el primer request se sigue procesando
+	expires time.Time
+	status  int
+	header  http.Header
+	body    []byte
+}
+
+func newIdempotency(ttl time.Duration, maxKeys int, maxBody int64, encode httptransport.ErrorEncoder) *idempotency {
+	if maxKeys <= 0 {
+		maxKeys = defaultIdempotencyMaxKeys
+	}
+
+	return &idempotency{
+		ttl:     ttl,
+		maxKeys: maxKeys,
+		maxBody: maxBody,
+		encode:  encode,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+func (i *idempotency) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := withRequest(r.Context(), r)
+		key := r.Header.Get(idempotencyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKey {
+			i.encode(ctx, decodeError(codeInvalidIdempotencyKey, "max", strconv.Itoa(maxIdempotencyKey)), w)
+			return
+		}
+
+		// Leemos el body para el hash y lo volvemos a dejar para el decoder
+		body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, i.maxBody))
+		if err != nil {
+			i.encode(ctx, bodyError(err), w)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// La key vale solo para la misma ruta
+		scope := r.Method + " " + r.URL.Path + " " + key
+		hash := requestHash(r, body)
+
+		entry, err := i.begin(scope, hash)
+		if err != nil {
+			i.encode(ctx, err, w)
+			return
+		}
+		if entry != nil {
+			entry.replay(w)
+			return
+		}
+
+		// Si el endpoint entra en panic no dejamos la key tomada
+		completed := false
+		defer func() {
+			if !completed {
+				i.forget(scope)
+			}
+		}()
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		completed = true
+
+		i.save(scope, rec)
+	})
+}
+
+// Devuelve la respuesta guardada si ya existe. Si no existe, reserva la key hasta que termine el request
+func (i *idempotency) begin(scope, hash string) (*idempotencyEntry, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(i.lastSweep) > idempotencySweep {
+		i.sweep(now)
+	}
+
+	entry, ok := i.entries[scope]
+	if ok && now.After(entry.expires) {
+		ok = false
+	}
+
+	if !ok {
+		if _, exists := i.entries[scope]; !exists && len(i.entries) >= i.maxKeys && !i.evict(now) {
+			return nil, newError(codeIdempotencyStoreFull, http.StatusServiceUnavailable)
+		}
+		i.entries[scope] = &idempotencyEntry{hash: hash, expires: now.Add(i.ttl)}
+		return nil, nil
+	}
+
+	if entry.hash != hash {
+		return nil, newError(codeIdempotencyKeyReused, http.StatusUnprocessableEntity)
+	}
+
+	if !entry.done {
+		return nil, newError(codeIdempotencyKeyInProcess, http.StatusConflict)
+	}
+
+	return entry, nil
+}
+
+func (i *idempotency) sweep(now time.Time) {
+	for k, e := range i.entries {
+		if now.After(e.expires) {
+			delete(i.entries, k)
+		}
+	}
+	i.lastSweep = now
+}
+
+// Hace lugar para una key nueva: primero sacamos las vencidas y si no alcanza la respuesta guardada mas vieja.
+// Las que se estan procesando no se tocan, si todas estan en proceso devuelve false
+func (i *idempotency) evict(now time.Time) bool {
+	i.sweep(now)
+	if len(i.entries) < i.maxKeys {
+		return true
+	}
+
+	oldest := ""
+	for k, e := range i.entries {
+		if e.done && (oldest == "" || e.expires.Before(i.entries[oldest].expires)) {
+			oldest = k
+		}
+	}
+	if oldest == "" {
+		return false
+	}
+
+	delete(i.entries, oldest)
+	return true
+}
+
+// Los errores 5xx no se guardan, asi el cliente puede reintentar
+func (i *idempotency) save(scope string, rec *responseRecorder) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if rec.status >= http.StatusInternalServerError {
+		delete(i.entries, scope)
+		return
+	}
+
+	entry, ok := i.entries[scope]
+	if !ok {
+		return
+	}
+
+	entry.done = true
+	entry.status = rec.status
+	// El X-Request-ID es de este request, el replay lleva el suyo
+	entry.header = rec.Header().Clone()
+	entry.header.Del(requestIDHeader)
+	entry.body = rec.body.Bytes()
+	entry.expires = time.Now().Add(i.ttl)
+}
+
+func (i *idempotency) forget(scope string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.entries, scope)
+}
+
+func (e *idempotencyEntry) replay(w http.ResponseWriter) {
+	for k, v := range e.header {
+		if k == http.CanonicalHeaderKey(requestIDHeader) {
+			continue
+		}
+		w.Header()[k] = v
+	}
+	w.Header().Set(idempotencyReplayed, "true")
+	w.WriteHeader(e.status)
+	_, _ = w.Write(e.body)
+}
+
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.RequestURI())
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Escribe la respuesta al cliente y se guarda una copia
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Para que http.NewResponseController llegue al ResponseWriter original
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
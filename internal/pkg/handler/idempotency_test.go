@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyBegin(t *testing.T) {
+	i := newIdempotency(time.Minute, 0, defaultMaxBodySize, nil)
+
+	// La primera vez reserva la key
+	if entry, err := i.begin("POST /users k1", "h1"); entry != nil || err != nil {
+		t.Fatalf("first begin = %v, %v, want nil, nil", entry, err)
+	}
+
+	// Mientras se procesa, otro request con la misma key es un 409
+	_, err := i.begin("POST /users k1", "h1")
+	checkCode(t, err, http.StatusConflict, codeIdempotencyKeyInProcess)
+
+	// Con otro body es un 422, aunque todavia se este procesando
+	_, err = i.begin("POST /users k1", "h2")
+	checkCode(t, err, http.StatusUnprocessableEntity, codeIdempotencyKeyReused)
+
+	i.save("POST /users k1", recorded(http.StatusCreated, `{"id":"1"}`))
+
+	entry, err := i.begin("POST /users k1", "h1")
+	if err != nil || entry == nil {
+		t.Fatalf("begin after save = %v, %v, want the saved entry", entry, err)
+	}
+	if entry.status != http.StatusCreated || string(entry.body) != `{"id":"1"}` {
+		t.Errorf("saved entry = %d %s", entry.status, entry.body)
+	}
+
+	// La misma key en otra ruta es otra entrada
+	if entry, err := i.begin("POST /users/bulk k1", "h1"); entry != nil || err != nil {
+		t.Errorf("other scope = %v, %v, want nil, nil", entry, err)
+	}
+}
+
+func TestIdempotencySave(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		saved  bool
+	}{
+		{name: "2xx se guarda", status: http.StatusCreated, saved: true},
+		{name: "4xx se guarda", status: http.StatusBadRequest, saved: true},
+		{name: "5xx se descarta", status: http.StatusServiceUnavailable, saved: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newIdempotency(time.Minute, 0, defaultMaxBodySize, nil)
+			_, _ = i.begin("k", "h")
+
+			rec := recorded(tt.status, "{}")
+			rec.Header().Set(requestIDHeader, "original")
+			i.save("k", rec)
+
+			entry, ok := i.entries["k"]
+			if ok != tt.saved {
+				t.Fatalf("saved = %v, want %v", ok, tt.saved)
+			}
+			if !ok {
+				return
+			}
+			if !entry.done || entry.status != tt.status {
+				t.Errorf("entry = done %v status %d", entry.done, entry.status)
+			}
+			if entry.header.Get(requestIDHeader) != "" {
+				t.Errorf("X-Request-ID was stored")
+			}
+		})
+	}
+}
+
+func TestIdempotencyExpiration(t *testing.T) {
+	i := newIdempotency(time.Minute, 0, defaultMaxBodySize, nil)
+	_, _ = i.begin("k", "h1")
+	i.save("k", recorded(http.StatusCreated, "{}"))
+	i.entries["k"].expires = time.Now().Add(-time.Second)
+
+	// Vencida se puede volver a usar, incluso con otro body
+	if entry, err := i.begin("k", "h2"); entry != nil || err != nil {
+		t.Errorf("begin on expired key = %v, %v, want nil, nil", entry, err)
+	}
+}
+
+func TestIdempotencyEvict(t *testing.T) {
+	i := newIdempotency(time.Minute, 2, defaultMaxBodySize, nil)
+	_, _ = i.begin("a", "h")
+	_, _ = i.begin("b", "h")
+
+	// Lleno y todas en proceso: no podemos hacer lugar
+	_, err := i.begin("c", "h")
+	checkCode(t, err, http.StatusServiceUnavailable, codeIdempotencyStoreFull)
+
+	// Las vencidas se sacan primero
+	i.save("a", recorded(http.StatusCreated, "{}"))
+	i.save("b", recorded(http.StatusCreated, "{}"))
+	i.entries["b"].expires = time.Now().Add(-time.Second)
+	if _, err := i.begin("c", "h"); err != nil {
+		t.Fatalf("begin with an expired entry: %v", err)
+	}
+	if _, ok := i.entries["a"]; !ok {
+		t.Errorf("evicted a live entry instead of the expired one")
+	}
+
+	// Si no hay vencidas, la respuesta guardada mas vieja. Las que estan en proceso (c) no se tocan
+	if _, err := i.begin("d", "h"); err != nil {
+		t.Fatalf("begin with a full store: %v", err)
+	}
+	if _, ok := i.entries["a"]; ok {
+		t.Errorf("oldest saved entry was not evicted")
+	}
+	if _, ok := i.entries["c"]; !ok {
+		t.Errorf("in-progress entry was evicted")
+	}
+	if len(i.entries) != 2 {
+		t.Errorf("len(entries) = %d, want 2", len(i.entries))
+	}
+}
+
+func TestIdempotencyWrap(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set(requestIDHeader, r.Header.Get(requestIDHeader))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"1"}`))
+	})
+	h := newIdempotency(time.Minute, 0, defaultMaxBodySize, newErrorEncoder(Config{}, discardLog())).wrap(next)
+
+	send := func(key, requestID, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+		r.Header.Set(idempotencyHeader, key)
+		r.Header.Set(requestIDHeader, requestID)
+		w := httptest.NewRecorder()
+		w.Header().Set(requestIDHeader, requestID) // Lo pone recoverPanics antes de llegar aca
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	first := send("k1", "req-1", `{"first_name":"Juan"}`)
+	replay := send("k1", "req-2", `{"first_name":"Juan"}`)
+
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+	if replay.Code != first.Code || replay.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %s, want %d %s", replay.Code, replay.Body, first.Code, first.Body)
+	}
+	if replay.Header().Get(idempotencyReplayed) != "true" || first.Header().Get(idempotencyReplayed) != "" {
+		t.Errorf("Idempotent-Replayed header = %q / %q", first.Header().Get(idempotencyReplayed), replay.Header().Get(idempotencyReplayed))
+	}
+	if got := replay.Header().Get(requestIDHeader); got != "req-2" {
+		t.Errorf("replayed X-Request-ID = %q, want req-2", got)
+	}
+
+	if w := send("k1", "req-3", `{"first_name":"Pedro"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key with another body = %d, want 422", w.Code)
+	}
+	if w := send(strings.Repeat("k", maxIdempotencyKey+1), "req-4", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("key too long = %d, want 400", w.Code)
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+}
+
+func recorded(status int, body string) *responseRecorder {
+	rec := &responseRecorder{ResponseWriter: httptest.NewRecorder(), status: status}
+	rec.body.WriteString(body)
+	return rec
+}
+
+func checkCode(t *testing.T, err error, status int, code string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected error %s, got nil", code)
+	}
+	resp := toErrorResponse(err)
+	if resp.Status != status || resp.Code != code {
+		t.Errorf("error = %d %s, want %d %s", resp.Status, resp.Code, status, code)
+	}
+}
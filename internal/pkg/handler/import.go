@@ -0,0 +1,167 @@
+package handler
+
+// Import de usuarios desde un CSV. El archivo puede venir como body (text/csv) o como campo "file" de un multipart.
+// La primera fila es el header, y con ella sabemos en que columna esta cada campo.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/juanjoaquin/back-g-user/internal/user"
+)
+
+// Nombres de columna aceptados => campo del CreateReq. Incluimos los nombres en castellano que usa RRHH
+var importColumns = map[string]string{
+	"first_name": "first_name",
+	"firstname":  "first_name",
+	"nombre":     "first_name",
+	"last_name":  "last_name",
+	"lastname":   "last_name",
+	"apellido":   "last_name",
+	"email":      "email",
+	"mail":       "email",
+	"correo":     "email",
+	"phone":      "phone",
+	"telefono":   "phone",
+	"teléfono":   "phone",
+}
+
+const maxMultipartMemory = 10 << 20
+
+func decodeImportUsers(_ context.Context, r *http.Request) (interface{}, error) {
+	body, err := importBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := parseImportCSV(body)
+	if err != nil {
+		return nil, err
+	}
+
+	dryRun, err := parseBoolParam(r.URL.Query(), "dry_run")
+	if err != nil {
+		return nil, err
+	}
+
+	return user.ImportReq{DryRun: dryRun, Rows: rows}, nil
+}
+
+// Si viene como multipart usamos el campo "file", si no el body completo
+func importBody(r *http.Request) (io.Reader, error) {
+	if err := checkContentType(r, csvContentTypes...); err != nil {
+		return nil, err
+	}
+
+	r.Body = http.MaxBytesReader(nil, r.Body, maxImportSize)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != multipartContentType {
+		return r.Body, nil
+	}
+
+	if err := r.ParseMultipartForm(maxMultipartMemory); err != nil {
+		return nil, bodyError(err)
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, decodeError(codeInvalidFormat, "error", err.Error())
+	}
+
+	return file, nil
+}
+
+func parseImportCSV(body io.Reader) ([]user.ImportRow, error) {
+	br := bufio.NewReader(body)
+
+	reader := csv.NewReader(br)
+	reader.Comma = detectDelimiter(br)
+	reader.FieldsPerRecord = -1 // Las planillas suelen tener filas con menos columnas
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, decodeError(codeEmptyFile)
+	}
+	if err != nil {
+		return nil, csvError(err)
+	}
+
+	// Posicion de cada campo en la fila
+	positions := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) // Excel agrega el BOM
+		name = strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+		if field, ok := importColumns[name]; ok {
+			positions[field] = i
+		}
+	}
+
+	for _, required := range []string{"first_name", "last_name"} {
+		if _, ok := positions[required]; !ok {
+			return nil, decodeError(codeMissingColumn, "column", required)
+		}
+	}
+
+	var rows []user.ImportRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, csvError(err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, user.ImportRow{
+			Line: line,
+			User: user.CreateReq{
+				FirstName: column(record, positions, "first_name"),
+				LastName:  column(record, positions, "last_name"),
+				Email:     column(record, positions, "email"),
+				Phone:     column(record, positions, "phone"),
+			},
+		})
+	}
+
+	return rows, nil
+}
+
+// Las planillas exportadas en castellano suelen usar ";" como separador. Lo detectamos mirando el header
+func detectDelimiter(br *bufio.Reader) rune {
+	peek, _ := br.Peek(br.Size())
+	if i := bytes.IndexByte(peek, '\n'); i >= 0 {
+		peek = peek[:i]
+	}
+
+	if bytes.Count(peek, []byte(";")) > bytes.Count(peek, []byte(",")) {
+		return ';'
+	}
+	return ','
+}
+
+func column(record []string, positions map[string]int, field string) string {
+	i, ok := positions[field]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// Si el archivo se pasa del tamaño maximo el reader corta con un error, lo devolvemos como 413
+func csvError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return bodyError(err)
+	}
+	return decodeError(codeInvalidCSV, "error", err.Error())
+}
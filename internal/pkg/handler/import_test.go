@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"bufio"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/juanjoaquin/back-g-user/internal/user"
+)
+
+func TestDetectDelimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want rune
+	}{
+		{name: "comas", csv: "first_name,last_name,email\nJuan,Perez,juan@mail.com\n", want: ','},
+		{name: "punto y coma", csv: "nombre;apellido;correo\nJuan;Perez;juan@mail.com\n", want: ';'},
+		{name: "solo mira el header", csv: "nombre,apellido\nJuan;Jose;Maria,Perez\n", want: ','},
+		{name: "header con comas adentro", csv: "nombre;apellido;\"notas, varias\"\n", want: ';'},
+		{name: "sin separador", csv: "nombre\nJuan\n", want: ','},
+		{name: "vacio", csv: "", want: ','},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectDelimiter(bufio.NewReader(strings.NewReader(tt.csv))); got != tt.want {
+				t.Errorf("detectDelimiter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImportCSV(t *testing.T) {
+	tests := []struct {
+		name   string
+		csv    string
+		want   []user.ImportRow
+		code   string // Codigo del error, vacio si no hay error
+		column string
+	}{
+		{
+			name: "header en ingles",
+			csv:  "first_name,last_name,email,phone\nJuan,Perez,juan@mail.com,011 4444-5555\n",
+			want: []user.ImportRow{{Line: 2, User: user.CreateReq{FirstName: "Juan", LastName: "Perez", Email: "juan@mail.com", Phone: "011 4444-5555"}}},
+		},
+		{
+			name: "header en castellano con punto y coma, BOM y columnas en otro orden",
+			csv:  "\ufeffCorreo;Apellido;Nombre;Teléfono\njuan@mail.com;Perez;Juan;1144445555\n",
+			want: []user.ImportRow{{Line: 2, User: user.CreateReq{FirstName: "Juan", LastName: "Perez", Email: "juan@mail.com", Phone: "1144445555"}}},
+		},
+		{
+			name: "nombres de columna con espacios y guiones",
+			csv:  "First Name,last-name\nJuan,Perez\n",
+			want: []user.ImportRow{{Line: 2, User: user.CreateReq{FirstName: "Juan", LastName: "Perez"}}},
+		},
+		{
+			name: "columnas desconocidas, filas cortas y espacios",
+			csv:  "first_name,notas,last_name,email\n  Juan , algo , Perez \nAna,,Gomez,ana@mail.com\n",
+			want: []user.ImportRow{
+				{Line: 2, User: user.CreateReq{FirstName: "Juan", LastName: "Perez"}},
+				{Line: 3, User: user.CreateReq{FirstName: "Ana", LastName: "Gomez", Email: "ana@mail.com"}},
+			},
+		},
+		{
+			name: "fila vacia y linea con salto dentro de comillas",
+			csv:  "first_name,last_name\n\"Juan\nJose\",Perez\n,\nAna,Gomez\n",
+			want: []user.ImportRow{
+				{Line: 2, User: user.CreateReq{FirstName: "Juan\nJose", LastName: "Perez"}},
+				{Line: 4},
+				{Line: 5, User: user.CreateReq{FirstName: "Ana", LastName: "Gomez"}},
+			},
+		},
+		{name: "solo header", csv: "first_name,last_name\n", want: nil},
+		{name: "archivo vacio", csv: "", code: codeEmptyFile},
+		{name: "falta el apellido", csv: "nombre,email\nJuan,juan@mail.com\n", code: codeMissingColumn, column: "last_name"},
+		{name: "falta el nombre", csv: "email\n", code: codeMissingColumn, column: "first_name"},
+		{name: "comillas sin cerrar", csv: "first_name,last_name\n\"Juan,Perez\n", code: codeInvalidCSV},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := parseImportCSV(strings.NewReader(tt.csv))
+
+			if tt.code != "" {
+				if err == nil {
+					t.Fatalf("expected error %s, got %+v", tt.code, rows)
+				}
+				resp := toErrorResponse(err)
+				if resp.Code != tt.code || resp.Status != http.StatusBadRequest {
+					t.Errorf("error = %d %s, want 400 %s", resp.Status, resp.Code, tt.code)
+				}
+				if tt.column != "" && resp.Params["column"] != tt.column {
+					t.Errorf("column = %q, want %q", resp.Params["column"], tt.column)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("rows = %+v, want %+v", rows, tt.want)
+			}
+		})
+	}
+}
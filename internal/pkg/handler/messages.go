@@ -0,0 +1,268 @@
+package handler
+
+// Catalogos de mensajes de error por idioma. Las claves son los codigos estables de los errores
+// (los del package user y los del decode), asi el cliente recibe el mensaje en su idioma pero el codigo no cambia.
+// Los valores entre llaves se reemplazan con los Params del error (ej: {user_id}).
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/juanjoaquin/back-g-response/response"
+	"github.com/juanjoaquin/back-g-user/internal/user"
+	"golang.org/x/text/language"
+)
+
+var catalogs = map[language.Tag]map[string]string{
+	language.English: {
+		// Validaciones
+		"validation-failed":   "the user data is not valid",
+		"first-name-required": "First Name is required",
+		"last-name-required":  "Last Name is required",
+		"field-too-long":      "{field} must have at most {max} characters",
+		"invalid-format":      "{field} has an invalid format",
+
+		// Errores del package user
+		"user-not-found":           "user '{user_id}' doesnt exists",
+		"user-not-deleted":         "user '{user_id}' is not deleted",
+		"email-already-exists":     "email '{email}' already exists",
+		"invalid-user-id":          "user id '{user_id}' is not a valid uuid",
+		"invalid-sort-field":       "sort field '{field}' is not allowed",
+		"invalid-field":            "field '{field}' is not allowed",
+		"invalid-patch-op":         "invalid patch operation '{op}' on path '{path}'",
+		"invalid-export-format":    "export format '{format}' is not supported",
+		"invalid-deleted-filter":   "deleted filter '{value}' is not valid, use 'only' or 'include'",
+		"invalid-cursor":           "invalid cursor",
+		"sort-with-cursor":         "sort is not supported with cursor pagination",
+		"relevance-without-search": "sort by relevance requires the q parameter",
+		"bulk-empty":               "at least one user is required",
+		"bulk-too-large":           "too many users in a single request",
+		"bulk-no-criteria":         "ids or filter are required",
+		"no-fields-to-update":      "at least one field to update is required",
+		"import-too-large":         "too many rows in the file",
+		"precondition-failed":      "user was modified by another request",
+		"precondition-required":    "If-Match header is required",
+		"patch-test-failed":        "patch test operation failed",
+
+		// Errores de la DB
+		"not-found":             "record not found",
+		"conflict":              "the request conflicts with the current state of the data",
+		"timeout":               "the database did not respond in time",
+		"unavailable":           "the database is unavailable",
+		"constraint-violation":  "the data violates a database constraint",
+		"internal-server-error": "internal server error",
+
+		// Errores del decode
+		codeInvalidFormat:           "invalid request format: '{error}'",
+		codeInvalidFieldValue:       "invalid value for '{field}'",
+		codeUnknownField:            "unknown field '{field}'",
+		codeEmptyBody:               "the request body is empty",
+		codeTrailingData:            "the request body must contain a single JSON value",
+		codeRequestTooLarge:         "the request body must be at most {max} bytes",
+		codeUnsupportedMediaType:    "unsupported Content-Type '{content_type}', use {accepted}",
+		codeInvalidParameter:        "invalid value '{value}' for parameter '{param}'",
+		codeInvalidCSV:              "invalid csv: '{error}'",
+		codeEmptyFile:               "the file is empty",
+		codeMissingColumn:           "missing '{column}' column in the header",
+		codeInvalidIdempotencyKey:   "Idempotency-Key must have at most {max} characters",
+		codeIdempotencyKeyReused:    "Idempotency-Key was already used with a different request",
+		codeIdempotencyKeyInProcess: "a request with the same Idempotency-Key is still in progress",
+		codeIdempotencyStoreFull:    "too many requests with Idempotency-Key in progress, try again later",
+	},
+	language.Spanish: {
+		// Validaciones
+		"validation-failed":   "los datos del usuario no son validos",
+		"first-name-required": "El nombre es obligatorio",
+		"last-name-required":  "El apellido es obligatorio",
+		"field-too-long":      "{field} debe tener como máximo {max} caracteres",
+		"invalid-format":      "{field} tiene un formato inválido",
+
+		// Errores del package user
+		"user-not-found":           "el usuario '{user_id}' no existe",
+		"user-not-deleted":         "el usuario '{user_id}' no está borrado",
+		"email-already-exists":     "el email '{email}' ya existe",
+		"invalid-user-id":          "el id de usuario '{user_id}' no es un uuid válido",
+		"invalid-sort-field":       "no se puede ordenar por '{field}'",
+		"invalid-field":            "el campo '{field}' no está permitido",
+		"invalid-patch-op":         "la operación de patch '{op}' sobre '{path}' no es válida",
+		"invalid-export-format":    "el formato de export '{format}' no está soportado",
+		"invalid-deleted-filter":   "el filtro deleted '{value}' no es válido, usá 'only' o 'include'",
+		"invalid-cursor":           "el cursor no es válido",
+		"sort-with-cursor":         "no se puede ordenar con la paginación por cursor",
+		"relevance-without-search": "para ordenar por relevancia se necesita el parámetro q",
+		"bulk-empty":               "se necesita al menos un usuario",
+		"bulk-too-large":           "hay demasiados usuarios en el request",
+		"bulk-no-criteria":         "se necesitan ids o filtros",
+		"no-fields-to-update":      "se necesita al menos un campo para modificar",
+		"import-too-large":         "el archivo tiene demasiadas filas",
+		"precondition-failed":      "el usuario fue modificado por otro request",
+		"precondition-required":    "el header If-Match es obligatorio",
+		"patch-test-failed":        "falló la operación test del patch",
+
+		// Errores de la DB
+		"not-found":             "no se encontró el registro",
+		"conflict":              "el request entra en conflicto con el estado actual de los datos",
+		"timeout":               "la base de datos no respondió a tiempo",
+		"unavailable":           "la base de datos no está disponible",
+		"constraint-violation":  "los datos no cumplen una restricción de la base de datos",
+		"internal-server-error": "error interno del servidor",
+
+		// Errores del decode
+		codeInvalidFormat:           "el formato del request es inválido: '{error}'",
+		codeInvalidFieldValue:       "el valor de '{field}' es inválido",
+		codeUnknownField:            "el campo '{field}' no existe",
+		codeEmptyBody:               "el body del request está vacío",
+		codeTrailingData:            "el body del request debe tener un solo valor JSON",
+		codeRequestTooLarge:         "el body del request debe tener como máximo {max} bytes",
+		codeUnsupportedMediaType:    "el Content-Type '{content_type}' no está soportado, usá {accepted}",
+		codeInvalidParameter:        "el valor '{value}' del parámetro '{param}' es inválido",
+		codeInvalidCSV:              "el csv es inválido: '{error}'",
+		codeEmptyFile:               "el archivo está vacío",
+		codeMissingColumn:           "falta la columna '{column}' en el header",
+		codeInvalidIdempotencyKey:   "el Idempotency-Key debe tener como máximo {max} caracteres",
+		codeIdempotencyKeyReused:    "el Idempotency-Key ya se usó con otro request",
+		codeIdempotencyKeyInProcess: "todavía se está procesando un request con el mismo Idempotency-Key",
+		codeIdempotencyStoreFull:    "hay demasiados requests con Idempotency-Key en proceso, intentá de nuevo más tarde",
+	},
+}
+
+// El primer idioma es el que se usa si el cliente no manda Accept-Language o no tenemos el que pide
+func newLanguageMatcher(defaultLanguage string) language.Matcher {
+	def, err := language.Parse(defaultLanguage)
+	if err != nil || (def != language.Spanish && def != language.English) {
+		def = language.English
+	}
+
+	tags := []language.Tag{def}
+	for tag := range catalogs {
+		if tag != def {
+			tags = append(tags, tag)
+		}
+	}
+	return language.NewMatcher(tags)
+}
+
+// Elegimos el catalogo segun el Accept-Language (es-AR => es)
+func negotiateLanguage(matcher language.Matcher, r *http.Request) language.Tag {
+	var accept string
+	if r != nil {
+		accept = r.Header.Get("Accept-Language")
+	}
+
+	tag, _ := language.MatchStrings(matcher, accept)
+	base, _ := tag.Base()
+	return language.Make(base.String())
+}
+
+// Devuelve una copia del error con los mensajes en el idioma pedido. Si un codigo no esta en el catalogo queda el mensaje original
+func localize(resp *user.ErrorResponse, lang language.Tag) *user.ErrorResponse {
+	localized := *resp
+	catalog, ok := catalogs[lang]
+	if !ok {
+		return &localized
+	}
+
+	if tmpl, ok := catalog[resp.Code]; ok {
+		localized.Message = render(tmpl, resp.Params)
+	}
+
+	if len(resp.Fields) > 0 {
+		localized.Fields = make(map[string]user.FieldError, len(resp.Fields))
+		for name, field := range resp.Fields {
+			if tmpl, ok := catalog[field.Code]; ok {
+				field.Message = render(tmpl, field.Params)
+			}
+			localized.Fields[name] = field
+		}
+
+		// En los de validacion el mensaje es la lista de errores por campo, igual que en el package user
+		if resp.Code == "validation-failed" {
+			localized.Message = joinFieldMessages(localized.Fields)
+		}
+	}
+
+	return &localized
+}
+
+// El alta masiva y el import responden 200 con un error por item. Los traducimos igual que las respuestas de error
+func newLocalizedEncoder(config Config) httptransport.EncodeResponseFunc {
+	matcher := newLanguageMatcher(config.DefaultLanguage)
+
+	return func(ctx context.Context, w http.ResponseWriter, resp interface{}) error {
+		if sr, ok := resp.(*response.SuccessResponse); ok {
+			lang := negotiateLanguage(matcher, requestFromContext(ctx))
+			switch data := sr.Data.(type) {
+			case []user.BulkItemResult:
+				for i := range data {
+					data[i].ItemError = localizeItem(data[i].ItemError, lang)
+				}
+			case user.ImportReport:
+				for i := range data.Rows {
+					data.Rows[i].ItemError = localizeItem(data.Rows[i].ItemError, lang)
+				}
+			}
+			w.Header().Set("Content-Language", lang.String())
+		}
+
+		return encodeResponse(ctx, w, resp)
+	}
+}
+
+func localizeItem(item user.ItemError, lang language.Tag) user.ItemError {
+	if item.Code == "" {
+		return item
+	}
+
+	resp := localize(&user.ErrorResponse{Message: item.Error, Code: item.Code, Fields: item.Errors, Params: item.Params}, lang)
+	item.Error, item.Errors = resp.Message, resp.Fields
+	return item
+}
+
+func render(tmpl string, params map[string]string) string {
+	if len(params) == 0 {
+		return tmpl
+	}
+
+	pairs := make([]string, 0, len(params)*2)
+	for k, v := range params {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(tmpl)
+}
+
+func joinFieldMessages(fields map[string]user.FieldError) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	messages := make([]string, 0, len(names))
+	for _, name := range names {
+		messages = append(messages, fields[name].Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Los errores del handler arman el mensaje en ingles con el mismo catalogo. params va de a pares: clave, valor
+func newError(code string, status int, params ...string) response.Response {
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i+1 < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+
+	return &user.ErrorResponse{
+		Message: render(catalogs[language.English][code], values),
+		Status:  status,
+		Code:    code,
+		Params:  values,
+	}
+}
+
+// Errores del decode (body o query params mal formados)
+func decodeError(code string, params ...string) response.Response {
+	return newError(code, http.StatusBadRequest, params...)
+}
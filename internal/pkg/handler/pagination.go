@@ -0,0 +1,75 @@
+package handler
+
+// Aqui armamos los headers de paginacion (RFC 8288) a partir del Meta que devuelve el endpoint de GetAll
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/juanjoaquin/back-g-meta/pkg/meta"
+)
+
+type contextKey string
+
+const requestKey contextKey = "request"
+
+// Guardamos el Request original en el Context, ya que los encoders de Go Kit no lo reciben
+func withRequest(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, requestKey, r)
+}
+
+func requestFromContext(ctx context.Context) *http.Request {
+	r, _ := ctx.Value(requestKey).(*http.Request)
+	return r
+}
+
+// Seteamos el X-Total-Count y los links first/prev/next/last
+func setPaginationHeaders(ctx context.Context, w http.ResponseWriter, m *meta.Meta) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(m.TotalCount))
+
+	r := requestFromContext(ctx)
+	if r == nil || m.PageCount == 0 {
+		return
+	}
+
+	links := []string{
+		pageLink(r.URL, 1, m.PerPage, "first"),
+	}
+	if m.Page > 1 {
+		links = append(links, pageLink(r.URL, m.Page-1, m.PerPage, "prev"))
+	}
+	if m.Page < m.PageCount {
+		links = append(links, pageLink(r.URL, m.Page+1, m.PerPage, "next"))
+	}
+	links = append(links, pageLink(r.URL, m.PageCount, m.PerPage, "last"))
+
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// Armamos el link manteniendo los filtros que mando el cliente, solo pisamos page y limit
+func pageLink(u *url.URL, page, limit int, rel string) string {
+	q := u.Query()
+	q.Set("page", strconv.Itoa(page))
+	q.Set("limit", strconv.Itoa(limit))
+
+	link := url.URL{Path: u.Path, RawQuery: q.Encode()}
+	return fmt.Sprintf("<%s>; rel=\"%s\"", link.String(), rel)
+}
+
+// En el modo cursor agregamos el link rel="next" con el cursor siguiente
+func setCursorHeaders(ctx context.Context, w http.ResponseWriter, next string) {
+	r := requestFromContext(ctx)
+	if r == nil || next == "" {
+		return
+	}
+
+	q := r.URL.Query()
+	q.Set("cursor", next)
+
+	link := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", link.String()))
+}
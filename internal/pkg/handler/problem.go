@@ -0,0 +1,146 @@
+package handler
+
+// Errores en formato application/problem+json (RFC 7807). Se usa si el cliente lo pide en el Accept
+// o si esta habilitado en la config. Si no, seguimos devolviendo el formato de siempre (message, status, data)
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/juanjoaquin/back-g-response/response"
+	"github.com/juanjoaquin/back-g-user/internal/user"
+)
+
+const (
+	problemContentType     = "application/problem+json"
+	defaultProblemTypeBase = "/problems/"
+)
+
+// Codigos de los errores del decode. Igual que los del package user, no se deben cambiar
+const (
+	codeInvalidFormat           = "invalid-request-format"
+	codeInvalidFieldValue       = "invalid-field-value"
+	codeUnknownField            = "unknown-field"
+	codeEmptyBody               = "empty-body"
+	codeTrailingData            = "trailing-data"
+	codeRequestTooLarge         = "request-too-large"
+	codeUnsupportedMediaType    = "unsupported-media-type"
+	codeInvalidParameter        = "invalid-parameter"
+	codeInvalidCSV              = "invalid-csv"
+	codeEmptyFile               = "empty-file"
+	codeMissingColumn           = "missing-column"
+	codeInvalidIdempotencyKey   = "invalid-idempotency-key"
+	codeIdempotencyKeyReused    = "idempotency-key-reused"
+	codeIdempotencyKeyInProcess = "idempotency-key-in-progress"
+	codeIdempotencyStoreFull    = "idempotency-store-full"
+)
+
+type problem struct {
+	Type      string                     `json:"type"`
+	Title     string                     `json:"title"`
+	Status    int                        `json:"status"`
+	Detail    string                     `json:"detail,omitempty"`
+	Instance  string                     `json:"instance,omitempty"`
+	Code      string                     `json:"code"`             // El mismo codigo que va al final del type, mas facil de leer
+	Errors    map[string]user.FieldError `json:"errors,omitempty"` // Errores por campo, con su codigo
+	RequestID string                     `json:"request_id,omitempty"`
+}
+
+// Elegimos el formato del error segun la config y el header Accept, y el idioma del mensaje segun el Accept-Language.
+// Los errores que no son un Response (no los armo ningun endpoint) se loguean con el id del request
+func newErrorEncoder(config Config, log *log.Logger) httptransport.ErrorEncoder {
+	matcher := newLanguageMatcher(config.DefaultLanguage)
+
+	return func(ctx context.Context, err error, w http.ResponseWriter) {
+		r := requestFromContext(ctx)
+		requestID := requestIDFromContext(ctx)
+
+		if _, ok := err.(response.Response); !ok {
+			method, path := "", ""
+			if r != nil {
+				method, path = r.Method, r.URL.Path
+			}
+			log.Println("[ERROR]-[HANDLER]", requestID, method, path, err)
+		}
+
+		lang := negotiateLanguage(matcher, r)
+		resp := localize(toErrorResponse(err), lang)
+		resp.RequestID = requestID
+		w.Header().Set("Content-Language", lang.String())
+
+		if config.ProblemJSON || acceptsProblem(r) {
+			encodeProblem(config, r, resp, w)
+			return
+		}
+		encodeError(ctx, resp, w)
+	}
+}
+
+// Capa central de traduccion de errores. Cualquier error termina como un ErrorResponse con su codigo:
+// los del package response les ponemos el codigo del status, y los errores comunes (de un decoder o un
+// endpoint que no armo el Response) los clasificamos igual que en el package user, si no sabemos que son es un 500
+func toErrorResponse(err error) *user.ErrorResponse {
+	var errResp *user.ErrorResponse
+	if errors.As(err, &errResp) {
+		return errResp
+	}
+
+	var resp response.Response
+	if errors.As(err, &resp) {
+		status := resp.StatusCode()
+		msg := resp.Error()
+		if s, ok := resp.(*response.SuccessResponse); ok {
+			msg = s.Message
+		}
+		return &user.ErrorResponse{Message: msg, Status: status, Code: user.StatusCode(status)}
+	}
+
+	return user.NewErrorResponse(err, user.ErrorStatus(err)).(*user.ErrorResponse)
+}
+
+func acceptsProblem(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(part)
+			if err == nil && mediaType == problemContentType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func encodeProblem(config Config, r *http.Request, resp *user.ErrorResponse, w http.ResponseWriter) {
+	p := problem{
+		Title:     http.StatusText(resp.Status),
+		Status:    resp.Status,
+		Detail:    resp.Message,
+		Code:      resp.Code,
+		Errors:    resp.Fields,
+		RequestID: resp.RequestID,
+	}
+
+	base := config.ProblemTypeBase
+	if base == "" {
+		base = defaultProblemTypeBase
+	}
+	p.Type = base + p.Code
+
+	if r != nil {
+		p.Instance = r.URL.Path
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(resp.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
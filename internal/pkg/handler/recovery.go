@@ -0,0 +1,96 @@
+package handler
+
+// Cada request lleva un id (el X-Request-ID que manda el cliente o uno nuevo) que devolvemos en el header y en los errores,
+// asi se puede buscar en los logs. Si algo entra en panic respondemos un 500 en JSON en vez de cortar la conexion
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+	"github.com/juanjoaquin/back-g-user/internal/user"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	maxRequestID    = 128
+)
+
+const requestIDKey contextKey = "request-id"
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func recoverPanics(log *log.Logger, encode httptransport.ErrorEncoder, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey, id))
+
+		tw := &trackingWriter{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			// Lo usa net/http para cortar la respuesta a proposito, lo dejamos seguir
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			log.Printf("[PANIC]-[HANDLER] %s %s %s: %v\n%s", id, r.Method, r.URL.Path, p, debug.Stack())
+
+			// Si ya mandamos el status no lo podemos cambiar, solo queda el log
+			if tw.wroteHeader {
+				return
+			}
+			encode(withRequest(r.Context(), r), newError(user.StatusCode(http.StatusInternalServerError), http.StatusInternalServerError), tw)
+		}()
+
+		next.ServeHTTP(tw, r)
+	})
+}
+
+// Solo aceptamos ids cortos y con caracteres que no rompan los logs ni los headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Guarda si ya se escribio el status, para saber si todavia podemos responder el 500
+type trackingWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (tw *trackingWriter) WriteHeader(status int) {
+	tw.wroteHeader = true
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *trackingWriter) Write(b []byte) (int, error) {
+	tw.wroteHeader = true
+	return tw.ResponseWriter.Write(b)
+}
+
+// Para que http.ResponseController (Flush del export) llegue al writer original
+func (tw *trackingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
@@ -6,8 +6,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"mime"
 	"net/http"
-	"strconv"
+	"net/url"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
 	httptransport "github.com/go-kit/kit/transport/http"
@@ -16,24 +19,46 @@ import (
 	"github.com/juanjoaquin/back-g-user/internal/user"
 )
 
-// Definimos la funcion. Recibira el Context y los Endpoints definidos.
-func NewUserHTTPServer(ctx context.Context, endpoints user.Endpoints) http.Handler {
+// Configuracion del transporte HTTP. Las Idempotency-Key se guardan en memoria: con varias instancias cada una
+// tiene las suyas, y un reintento que cae en otra instancia se vuelve a ejecutar
+type Config struct {
+	IdempotencyTTL     time.Duration // Cuanto tiempo guardamos las respuestas de los requests con Idempotency-Key
+	IdempotencyMaxKeys int           // Cantidad maxima de keys guardadas (por defecto 10000)
+	ProblemJSON        bool          // Devuelve siempre los errores como problem+json, aunque el cliente no lo pida
+	ProblemTypeBase    string        // Prefijo del type de los problem+json (ej: https://api.example.com/problems/)
+	DefaultLanguage    string        // Idioma de los mensajes de error si el cliente no manda Accept-Language (es o en)
+
+	MaxBodySize           int64 // Tamaño maximo de los bodies JSON en bytes (por defecto 1MB)
+	DisallowUnknownFields bool  // Rechaza los bodies con campos que no existen
+}
+
+// Definimos la funcion. Recibira el Context, los Endpoints definidos y la config del transporte.
+func NewUserHTTPServer(ctx context.Context, log *log.Logger, endpoints user.Endpoints, config Config) http.Handler {
 
 	router := mux.NewRouter()
 
-	// Manejo de Errores con Go Kit
+	// Manejo de Errores con Go Kit. El formato depende de la config y del Accept
+	errorEncoder := newErrorEncoder(config, log)
 	opts := []httptransport.ServerOption{
-		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerBefore(withRequest),               // Guardamos el Request en el Context para usarlo en los encoders
+		httptransport.ServerBefore(withDecodeOptions(config)), // Y la config del decode para los decoders
 	}
 
+	// Las respuestas con errores por item (alta masiva e import) tambien se traducen
+	itemsEncoder := newLocalizedEncoder(config)
+
+	// Las rutas que lo necesiten se envuelven con idem.wrap
+	idem := newIdempotency(config.IdempotencyTTL, config.IdempotencyMaxKeys, maxBodySize(config), errorEncoder)
+
 	//No usamos router.HandleFunc() como estabamos usando. Usaremos Handle de Gorilla Mux
 	// Tampoco nos traeremos el userEndpoint. Usaremos el httptransport.NewServer() de Go Kit
-	router.Handle("/users", httptransport.NewServer(
+	router.Handle("/users", idem.wrap(httptransport.NewServer(
 		endpoint.Endpoint(endpoints.Create), // Debemos hacer una conversion. Llamamos al Endpoint de GO KIT, y lo encapsulamos dentro del endpoints.Create del Controller
 		decodeCreateUser,
 		encodeResponse,
 		opts..., // Tambien le pasamos el OPTS del Middleware para descrifar los errores
-	)).Methods("POST")
+	))).Methods("POST")
 	/* EXPLICACION DE LOS PARAMETROS Y LA FUNCIONES:
 	El handle primero va a enviar al Decode el POST para crear el usuario. Este Decode ejecuta la funcion, y hace la conversion.
 	En caso de que no puede generara un error. Si esta OK, enviara la Request 200.
@@ -41,6 +66,34 @@ func NewUserHTTPServer(ctx context.Context, endpoints user.Endpoints) http.Handl
 	Despues pasa el encodeResponse donde recibe la respuesta, y accede a la creacion y al status 200.
 	*/
 
+	router.Handle("/users/bulk", extendDeadlines(longRequestTimeout, httptransport.NewServer(
+		endpoint.Endpoint(endpoints.BulkCreate),
+		decodeBulkCreateUsers,
+		itemsEncoder,
+		opts...,
+	))).Methods("POST")
+
+	router.Handle("/users/import", extendDeadlines(longRequestTimeout, httptransport.NewServer(
+		endpoint.Endpoint(endpoints.Import),
+		decodeImportUsers,
+		itemsEncoder,
+		opts...,
+	))).Methods("POST")
+
+	router.Handle("/users", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.BulkUpdate),
+		decodeBulkUpdateUsers,
+		encodeResponse,
+		opts...,
+	)).Methods("PATCH")
+
+	router.Handle("/users", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.BulkDelete),
+		decodeBulkDeleteUsers,
+		encodeResponse,
+		opts...,
+	)).Methods("DELETE")
+
 	router.Handle("/users", httptransport.NewServer(
 		endpoint.Endpoint(endpoints.GetAll),
 		decodeGetAllUsers,
@@ -48,6 +101,14 @@ func NewUserHTTPServer(ctx context.Context, endpoints user.Endpoints) http.Handl
 		opts...,
 	)).Methods("GET")
 
+	// Tiene que estar antes de /users/{id}, si no Gorilla Mux lo toma como un id
+	router.Handle("/users/export", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.Export),
+		decodeExportUsers,
+		newExportEncoder(log),
+		opts...,
+	)).Methods("GET")
+
 	router.Handle("/users/{id}", httptransport.NewServer(
 		endpoint.Endpoint(endpoints.Get),
 		decodeGetUser,
@@ -62,6 +123,13 @@ func NewUserHTTPServer(ctx context.Context, endpoints user.Endpoints) http.Handl
 		opts...,
 	)).Methods("PATCH")
 
+	router.Handle("/users/{id}", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.Replace),
+		decodeReplaceUser,
+		encodeResponse,
+		opts...,
+	)).Methods("PUT")
+
 	router.Handle("/users/{id}", httptransport.NewServer(
 		endpoint.Endpoint(endpoints.Delete),
 		decodeDeleteUser,
@@ -69,15 +137,33 @@ func NewUserHTTPServer(ctx context.Context, endpoints user.Endpoints) http.Handl
 		opts...,
 	)).Methods("DELETE")
 
-	return router
+	router.Handle("/users/{id}/restore", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.Restore),
+		decodeRestoreUser,
+		encodeResponse,
+		opts...,
+	)).Methods("POST")
+
+	// El recovery va por fuera de todo, asi tambien cubre los panics del idempotency y de los decoders
+	return recoverPanics(log, errorEncoder, router)
 }
 
 // Esta funcion se encarga de hacer un Decode dentro del request cuando nosotros hagamos el store de un User
-func decodeCreateUser(_ context.Context, r *http.Request) (interface{}, error) {
+func decodeCreateUser(ctx context.Context, r *http.Request) (interface{}, error) {
 	// Definimos la Request del CreateReq
 	var req user.CreateReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		return nil, response.BadRequest(fmt.Sprintf("invalid request format: '%v'", err.Error())) // Le pasamos el package del Response
+	if err := decodeJSON(ctx, r, &req); err != nil {
+		return nil, err // Ya viene como el package del Response
+	}
+
+	return req, nil
+}
+
+// El body del alta masiva es un array de usuarios
+func decodeBulkCreateUsers(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req user.BulkCreateReq
+	if err := decodeJSON(ctx, r, &req.Users); err != nil {
+		return nil, err
 	}
 
 	return req, nil
@@ -86,47 +172,218 @@ func decodeCreateUser(_ context.Context, r *http.Request) (interface{}, error) {
 // Hacemos un Enconde del Response.
 // Esto lo que va a devolver despues el Endpoint una vez que retorne
 func encodeResponse(ctx context.Context, w http.ResponseWriter, resp interface{}) error {
-	// Hacemos un reconverse de nuestro Package de Response
-	r := resp.(response.Response)
+	// Hacemos un reconverse de nuestro Package de Response. Si el endpoint devolvio otra cosa, el error encoder responde un 500
+	r, ok := resp.(response.Response)
+	if !ok {
+		return fmt.Errorf("unexpected response type %T", resp)
+	}
+	// Si la respuesta trae Meta (listados paginados), agregamos los headers de paginacion
+	if sr, ok := r.(*response.SuccessResponse); ok {
+		if sr.Meta != nil {
+			setPaginationHeaders(ctx, w, sr.Meta)
+		}
+		// En el modo cursor solo tenemos el link a la pagina siguiente
+		if page, ok := sr.Data.(user.CursorPage); ok {
+			setCursorHeaders(ctx, w, page.NextCursor)
+		}
+	}
+
+	// Armamos el body antes de escribirlo, el ETag de los listados sale de el
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+
+	// Si el cliente ya tiene esta version, respondemos 304 sin body
+	if setCacheHeaders(ctx, w, r, body) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(r.StatusCode())       // Esto tambien
-	return json.NewEncoder(w).Encode(r) // Retornamos el response
+	w.WriteHeader(r.StatusCode()) // Esto tambien
+	_, err = w.Write(body)        // Retornamos el response
+	return err
 }
 
 // Aqui pasara por otra instancia donde decodifica el Error. En caso de haber un error por ejemplo un 400. Lo descifra.
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	resp := err.(response.Response) // Hacemos una conversion del Error al Response
+	resp := toErrorResponse(err) // Hacemos una conversion del Error al Response, sea cual sea el error
 	w.WriteHeader(resp.StatusCode())
 	_ = json.NewEncoder(w).Encode(resp) // No debemos hacer un return. Solo mapearle al response que recibimos por parametro, lo que queremos retornar al cliente
 
 }
 
-func decodeUpdateUser(_ context.Context, r *http.Request) (interface{}, error) {
+func decodeUpdateUser(ctx context.Context, r *http.Request) (interface{}, error) {
 	var req user.UpdateReq
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		return nil, response.BadRequest(fmt.Sprintf("invalid request format '%v'", err.Error()))
+	// Segun el Content-Type el body puede ser el objeto de siempre, un JSON Merge Patch o un JSON Patch
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case mergePatchContentType:
+		if err := decodeMergePatch(ctx, r, &req); err != nil {
+			return nil, err
+		}
+	case jsonPatchContentType:
+		if err := decodeJSON(ctx, r, &req.Ops, jsonPatchContentType); err != nil {
+			return nil, err
+		}
+		if req.Ops == nil {
+			req.Ops = []user.PatchOp{}
+		}
+	default:
+		if err := decodeJSON(ctx, r, &req, jsonContentType, mergePatchContentType, jsonPatchContentType); err != nil {
+			return nil, err
+		}
 	}
+
 	path := mux.Vars(r)
 	req.ID = path["id"]
+	req.IfMatch = r.Header.Get("If-Match")
+	return req, nil
+
+}
+
+// JSON Merge Patch (RFC 7396): los campos que vienen se modifican y el null los deja vacios
+func decodeMergePatch(ctx context.Context, r *http.Request, req *user.UpdateReq) error {
+	var body map[string]json.RawMessage
+	if err := decodeJSON(ctx, r, &body, mergePatchContentType); err != nil {
+		return err
+	}
+
+	fields := map[string]**string{
+		"first_name": &req.FirstName,
+		"last_name":  &req.LastName,
+		"email":      &req.Email,
+		"phone":      &req.Phone,
+	}
+
+	for name, raw := range body {
+		field, ok := fields[name]
+		if !ok {
+			// Al ser un map el decode no los puede rechazar, lo hacemos aca
+			if decodeOptionsFromContext(ctx).disallowUnknownFields {
+				return decodeError(codeUnknownField, "field", name)
+			}
+			continue
+		}
+
+		var value *string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return decodeError(codeInvalidFieldValue, "field", name)
+		}
+		if value == nil {
+			value = new(string)
+		}
+		*field = value
+	}
+
+	return nil
+}
+
+// En el PUT viene el usuario completo
+func decodeReplaceUser(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req user.ReplaceReq
+
+	if err := decodeJSON(ctx, r, &req); err != nil {
+		return nil, err
+	}
+	req.ID = mux.Vars(r)["id"]
+	req.IfMatch = r.Header.Get("If-Match")
 	return req, nil
+}
 
+// Body de la modificacion masiva: los ids y/o un filter con los mismos nombres que los query params del GET /users
+func decodeBulkUpdateUsers(ctx context.Context, r *http.Request) (interface{}, error) {
+	var body struct {
+		IDs       []string          `json:"ids"`
+		Filter    map[string]string `json:"filter"`
+		FirstName *string           `json:"first_name"`
+		LastName  *string           `json:"last_name"`
+		Email     *string           `json:"email"`
+		Phone     *string           `json:"phone"`
+	}
+
+	if err := decodeJSON(ctx, r, &body); err != nil {
+		return nil, err
+	}
+
+	// Un typo en el filter (ej: emial) no se puede ignorar, si no terminamos modificando a todos los usuarios
+	v := url.Values{}
+	for key, value := range body.Filter {
+		if !filterParams[key] {
+			return nil, decodeError(codeUnknownField, "field", "filter."+key)
+		}
+		v.Set(key, value)
+	}
+
+	filters, err := decodeFilters(v)
+	if err != nil {
+		return nil, err
+	}
+	filters.IDs = append(filters.IDs, body.IDs...)
+
+	req := user.BulkUpdateReq{
+		Filters:   filters,
+		FirstName: body.FirstName,
+		LastName:  body.LastName,
+		Email:     body.Email,
+		Phone:     body.Phone,
+	}
+
+	return req, nil
+}
+
+func decodeBulkDeleteUsers(_ context.Context, r *http.Request) (interface{}, error) {
+	// Igual que en la modificacion masiva: con un typo (ej: frist_name) borrariamos por el resto de los filtros
+	v := r.URL.Query()
+	for key := range v {
+		if !filterParams[key] {
+			return nil, decodeError(codeUnknownField, "field", key)
+		}
+	}
+
+	filters, err := decodeFilters(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.BulkDeleteReq{Filters: filters}, nil
 }
 
 func decodeDeleteUser(_ context.Context, r *http.Request) (interface{}, error) {
 	path := mux.Vars(r)
 	req := user.DeleteReq{
-		ID: path["id"],
+		ID:      path["id"],
+		IfMatch: r.Header.Get("If-Match"),
+	}
+
+	purge, err := parseBoolParam(r.URL.Query(), "purge")
+	if err != nil {
+		return nil, err
 	}
+	req.Purge = purge
 
 	return req, nil
 }
 
+func decodeRestoreUser(_ context.Context, r *http.Request) (interface{}, error) {
+	path := mux.Vars(r)
+	return user.RestoreReq{ID: path["id"]}, nil
+}
+
 func decodeGetUser(_ context.Context, r *http.Request) (interface{}, error) {
 	p := mux.Vars(r)
+	fields, err := user.ParseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		return nil, user.NewErrorResponse(err, http.StatusBadRequest)
+	}
+
 	req := user.GetReq{
-		ID: p["id"],
+		ID:     p["id"],
+		Fields: fields,
 	}
 	return req, nil
 }
@@ -134,14 +391,50 @@ func decodeGetUser(_ context.Context, r *http.Request) (interface{}, error) {
 func decodeGetAllUsers(_ context.Context, r *http.Request) (interface{}, error) {
 	v := r.URL.Query()
 
-	limit, _ := strconv.Atoi(v.Get("limit"))
-	page, _ := strconv.Atoi(v.Get("page"))
+	limit, err := parseIntParam(v, "limit")
+	if err != nil {
+		return nil, err
+	}
+	page, err := parseIntParam(v, "page")
+	if err != nil {
+		return nil, err
+	}
+
+	// Validamos el orden contra la whitelist del package user
+	sort, err := user.ParseSort(v.Get("sort"))
+	if err != nil {
+		return nil, user.NewErrorResponse(err, http.StatusBadRequest)
+	}
+
+	filters, err := decodeFilters(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// Solo el listado puede ver los borrados, las operaciones masivas no
+	filters.Deleted, err = user.ParseDeleted(v.Get("deleted"))
+	if err != nil {
+		return nil, user.NewErrorResponse(err, http.StatusBadRequest)
+	}
+
+	// Sparse fieldset (ej: fields=id,first_name)
+	fields, err := user.ParseFields(v.Get("fields"))
+	if err != nil {
+		return nil, user.NewErrorResponse(err, http.StatusBadRequest)
+	}
 
 	req := user.GetAllReq{
-		FirstName: v.Get("first_name"),
-		LastName:  v.Get("last_name"),
-		Limit:     limit,
-		Page:      page,
+		Filters: filters,
+		Limit:   limit,
+		Page:    page,
+		Sort:    sort,
+		Fields:  fields,
+	}
+
+	// Si mandan el param cursor (aunque sea vacio) pasamos al modo keyset
+	if v.Has("cursor") {
+		cursor := v.Get("cursor")
+		req.Cursor = &cursor
 	}
 
 	return req, nil
@@ -0,0 +1,173 @@
+package user
+
+// Clasificacion de los errores de la DB (GORM y driver de MySQL). El repositorio devuelve los errores ya clasificados,
+// asi los endpoints no confunden una caida de la DB o un timeout con un usuario que no existe.
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+type ErrorKind string
+
+const (
+	KindNotFound    ErrorKind = "not-found"
+	KindConflict    ErrorKind = "conflict"
+	KindTimeout     ErrorKind = "timeout" // Tambien cuando se cancela el request
+	KindUnavailable ErrorKind = "unavailable"
+	KindConstraint  ErrorKind = "constraint-violation"
+	KindInternal    ErrorKind = "internal"
+
+	// Estas dos no salen de la DB, son errores del package que el endpoint no puede validar antes de llamar al service
+	KindPrecondition ErrorKind = "precondition-failed" // El If-Match no coincide con la version actual
+	KindInvalid      ErrorKind = "invalid"             // El request no se puede procesar (ej: el filtro afecta demasiados usuarios)
+)
+
+// Mensaje que ve el cliente. El error original solo va al log, no queremos mostrar detalles de la DB
+var kindMessages = map[ErrorKind]string{
+	KindNotFound:    "record not found",
+	KindConflict:    "the request conflicts with the current state of the data",
+	KindTimeout:     "the database did not respond in time",
+	KindUnavailable: "the database is unavailable",
+	KindConstraint:  "the data violates a database constraint",
+}
+
+// Status HTTP de cada clase de error
+var kindStatus = map[ErrorKind]int{
+	KindNotFound:    http.StatusNotFound,
+	KindConflict:    http.StatusConflict,
+	KindTimeout:     http.StatusGatewayTimeout,
+	KindUnavailable: http.StatusServiceUnavailable,
+	KindConstraint:  http.StatusInternalServerError,
+	KindInternal:    http.StatusInternalServerError,
+
+	KindPrecondition: http.StatusPreconditionFailed,
+	KindInvalid:      http.StatusBadRequest,
+}
+
+// Codigos de error de MySQL que nos interesan
+const (
+	mysqlDuplicateEntry      = 1062
+	mysqlTooManyConnections  = 1040
+	mysqlServerShutdown      = 1053
+	mysqlLockWaitTimeout     = 1205
+	mysqlDeadlock            = 1213
+	mysqlMaxExecutionTime    = 3024
+	mysqlColumnCannotBeNull  = 1048
+	mysqlOutOfRange          = 1264
+	mysqlDataTooLong         = 1406
+	mysqlRowIsReferenced     = 1451
+	mysqlNoReferencedRow     = 1452
+	mysqlCheckConstraintFail = 3819
+)
+
+const errDBClosed = "sql: database is closed"
+
+// Error de la DB ya clasificado
+type StoreError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *StoreError) Error() string {
+	if msg, ok := kindMessages[e.Kind]; ok {
+		return msg
+	}
+	return e.Err.Error()
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+// Traducimos el error de GORM/MySQL a un StoreError. Los errores del package (ej: ErrUserNotFound) quedan como estan
+func translateError(err error) error {
+	if err == nil || isDomainError(err) {
+		return err
+	}
+	return &StoreError{Kind: classify(err), Err: err}
+}
+
+func isDomainError(err error) bool {
+	var store *StoreError
+	return errors.As(err, &store) ||
+		errors.As(err, &ErrUserNotFound{}) ||
+		errors.As(err, &ErrUserNotDeleted{}) ||
+		errors.As(err, &ErrEmailAlreadyExists{}) ||
+		errors.Is(err, ErrPreconditionFailed) ||
+		errors.Is(err, ErrBulkTooLarge)
+}
+
+func classify(err error) ErrorKind {
+	var mysqlErr *mysql.MySQLError
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return KindNotFound
+	case isDuplicateKey(err):
+		return KindConflict
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return KindTimeout
+	case errors.Is(err, gorm.ErrForeignKeyViolated), errors.Is(err, gorm.ErrCheckConstraintViolated):
+		return KindConstraint
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, mysql.ErrInvalidConn), errors.Is(err, sql.ErrConnDone),
+		strings.Contains(err.Error(), errDBClosed): // database/sql no exporta este error
+		return KindUnavailable
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return KindTimeout
+		}
+		return KindUnavailable
+	case errors.As(err, &mysqlErr):
+		switch mysqlErr.Number {
+		case mysqlLockWaitTimeout, mysqlMaxExecutionTime:
+			return KindTimeout
+		case mysqlDeadlock:
+			return KindConflict
+		case mysqlTooManyConnections, mysqlServerShutdown:
+			return KindUnavailable
+		case mysqlColumnCannotBeNull, mysqlOutOfRange, mysqlDataTooLong, mysqlRowIsReferenced, mysqlNoReferencedRow, mysqlCheckConstraintFail:
+			return KindConstraint
+		}
+	}
+
+	return KindInternal
+}
+
+// Con TranslateError GORM ya convierte el 1062 en ErrDuplicatedKey, pero chequeamos los dos por las dudas
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.Is(err, gorm.ErrDuplicatedKey) || (errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry)
+}
+
+// Clase de cualquier error que devuelva el service
+func KindOf(err error) ErrorKind {
+	var store *StoreError
+	switch {
+	case errors.As(err, &store):
+		return store.Kind
+	case errors.As(err, &ErrUserNotFound{}):
+		return KindNotFound
+	case errors.As(err, &ErrUserNotDeleted{}), errors.As(err, &ErrEmailAlreadyExists{}):
+		return KindConflict
+	case errors.Is(err, ErrPreconditionFailed):
+		return KindPrecondition
+	case errors.Is(err, ErrBulkTooLarge):
+		return KindInvalid
+	}
+	return classify(err)
+}
+
+// Status HTTP de cualquier error que devuelva el service
+func ErrorStatus(err error) int {
+	return kindStatus[KindOf(err)]
+}
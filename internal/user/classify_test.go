@@ -0,0 +1,121 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+type netError struct{ timeout bool }
+
+func (e netError) Error() string   { return "network error" }
+func (e netError) Timeout() bool   { return e.timeout }
+func (e netError) Temporary() bool { return false }
+
+var _ net.Error = netError{}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{name: "not found", err: gorm.ErrRecordNotFound, want: KindNotFound},
+		{name: "duplicado de GORM", err: gorm.ErrDuplicatedKey, want: KindConflict},
+		{name: "duplicado de MySQL", err: &mysql.MySQLError{Number: mysqlDuplicateEntry}, want: KindConflict},
+		{name: "deadlock", err: &mysql.MySQLError{Number: mysqlDeadlock}, want: KindConflict},
+		{name: "deadline del context", err: context.DeadlineExceeded, want: KindTimeout},
+		{name: "request cancelado", err: fmt.Errorf("query: %w", context.Canceled), want: KindTimeout},
+		{name: "lock wait timeout", err: &mysql.MySQLError{Number: mysqlLockWaitTimeout}, want: KindTimeout},
+		{name: "max execution time", err: &mysql.MySQLError{Number: mysqlMaxExecutionTime}, want: KindTimeout},
+		{name: "timeout de red", err: netError{timeout: true}, want: KindTimeout},
+		{name: "conexion rechazada", err: netError{}, want: KindUnavailable},
+		{name: "conexion invalida", err: driver.ErrBadConn, want: KindUnavailable},
+		{name: "conexion cerrada", err: sql.ErrConnDone, want: KindUnavailable},
+		{name: "DB cerrada", err: errors.New(errDBClosed), want: KindUnavailable},
+		{name: "demasiadas conexiones", err: &mysql.MySQLError{Number: mysqlTooManyConnections}, want: KindUnavailable},
+		{name: "foreign key de GORM", err: gorm.ErrForeignKeyViolated, want: KindConstraint},
+		{name: "dato muy largo", err: &mysql.MySQLError{Number: mysqlDataTooLong}, want: KindConstraint},
+		{name: "check constraint", err: &mysql.MySQLError{Number: mysqlCheckConstraintFail}, want: KindConstraint},
+		{name: "otro error de MySQL", err: &mysql.MySQLError{Number: 1064}, want: KindInternal},
+		{name: "desconocido", err: errors.New("boom"), want: KindInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(tt.err); got != tt.want {
+				t.Errorf("classify(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{name: "usuario inexistente", err: ErrUserNotFound{"1"}, status: http.StatusNotFound, code: "user-not-found"},
+		{name: "email repetido", err: ErrEmailAlreadyExists{"juan@mail.com"}, status: http.StatusConflict, code: "email-already-exists"},
+		{name: "restore de uno no borrado", err: ErrUserNotDeleted{"1"}, status: http.StatusConflict, code: "user-not-deleted"},
+		{name: "If-Match que no coincide", err: ErrPreconditionFailed, status: http.StatusPreconditionFailed, code: "precondition-failed"},
+		{name: "operacion masiva muy grande", err: ErrBulkTooLarge, status: http.StatusBadRequest, code: "bulk-too-large"},
+		{name: "timeout ya traducido", err: translateError(context.DeadlineExceeded), status: http.StatusGatewayTimeout, code: "timeout"},
+		{name: "DB caida ya traducida", err: translateError(driver.ErrBadConn), status: http.StatusServiceUnavailable, code: "unavailable"},
+		{name: "constraint", err: translateError(gorm.ErrCheckConstraintViolated), status: http.StatusInternalServerError, code: "constraint-violation"},
+		{name: "error envuelto", err: fmt.Errorf("update: %w", ErrUserNotFound{"1"}), status: http.StatusNotFound, code: "user-not-found"},
+		{name: "sin traducir", err: gorm.ErrRecordNotFound, status: http.StatusNotFound, code: "not-found"},
+		{name: "desconocido", err: errors.New("boom"), status: http.StatusInternalServerError, code: "internal-server-error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := ErrorStatus(tt.err)
+			if status != tt.status {
+				t.Errorf("ErrorStatus(%v) = %d, want %d", tt.err, status, tt.status)
+			}
+			if code := ErrorCode(tt.err, status); code != tt.code {
+				t.Errorf("ErrorCode(%v) = %q, want %q", tt.err, code, tt.code)
+			}
+		})
+	}
+}
+
+// Los errores del package no se envuelven, y el cliente nunca ve el detalle de la DB
+func TestTranslateError(t *testing.T) {
+	if translateError(nil) != nil {
+		t.Errorf("translateError(nil) != nil")
+	}
+
+	domainErr := ErrEmailAlreadyExists{"juan@mail.com"}
+	if got := translateError(domainErr); got != error(domainErr) {
+		t.Errorf("translateError(domain error) = %#v, want it unchanged", got)
+	}
+
+	dbErr := &mysql.MySQLError{Number: mysqlTooManyConnections, Message: "Too many connections"}
+	got := translateError(dbErr)
+
+	var store *StoreError
+	if !errors.As(got, &store) || store.Kind != KindUnavailable {
+		t.Fatalf("translateError = %#v, want an unavailable StoreError", got)
+	}
+	if got.Error() != kindMessages[KindUnavailable] {
+		t.Errorf("message = %q, want %q", got.Error(), kindMessages[KindUnavailable])
+	}
+	if !errors.Is(got, dbErr) {
+		t.Errorf("original error not wrapped")
+	}
+	if translateError(got) != got {
+		t.Errorf("translating twice wrapped the error again")
+	}
+}
@@ -0,0 +1,52 @@
+package user
+
+// Aqui manejamos el cursor opaco de la paginacion por keyset (created_at + id).
+// El cliente solo ve un string en base64, nosotros lo decodificamos para armar el WHERE del repositorio.
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// Pagina que devolvemos cuando se usa el modo cursor. El next_cursor viene vacio en la ultima pagina
+// Users puede ser la lista de User o solo los campos pedidos (ver fields.go)
+type CursorPage struct {
+	Users      interface{} `json:"users"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// Generamos el cursor a partir del ultimo usuario de la pagina
+func encodeCursor(u User) string {
+	c := Cursor{ID: u.ID}
+	if u.CreatedAt != nil {
+		c.CreatedAt = *u.CreatedAt
+	}
+
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Un cursor vacio significa arrancar desde el principio
+func decodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,61 @@
+package user
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/juanjoaquin/back-g-domain/domain"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	created := time.Date(2024, 5, 10, 12, 30, 0, 123000000, time.UTC)
+	encoded := encodeCursor(User{User: domain.User{ID: "a1b2", CreatedAt: &created}})
+
+	tests := []struct {
+		name  string
+		input string
+		want  *Cursor
+		err   error
+	}{
+		{name: "vacio arranca desde el principio", input: "", want: nil},
+		{name: "el que generamos", input: encoded, want: &Cursor{CreatedAt: created, ID: "a1b2"}},
+		{name: "no es base64", input: "%%%", err: ErrInvalidCursor},
+		{name: "base64 con padding", input: base64.URLEncoding.EncodeToString([]byte(`{"id":"a1b2"}`)) + "==", err: ErrInvalidCursor},
+		{name: "no es JSON", input: b64(`not json`), err: ErrInvalidCursor},
+		{name: "sin id", input: b64(`{"t":"2024-05-10T12:30:00Z"}`), err: ErrInvalidCursor},
+		{name: "fecha invalida", input: b64(`{"t":"ayer","id":"a1b2"}`), err: ErrInvalidCursor},
+		{name: "sin fecha", input: b64(`{"id":"a1b2"}`), want: &Cursor{ID: "a1b2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(tt.input)
+
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if tt.want == nil || got == nil {
+				if tt.want != got {
+					t.Fatalf("decodeCursor(%q) = %+v, want %+v", tt.input, got, tt.want)
+				}
+				return
+			}
+			if got.ID != tt.want.ID || !got.CreatedAt.Equal(tt.want.CreatedAt) {
+				t.Errorf("decodeCursor(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func b64(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
@@ -0,0 +1,20 @@
+package user
+
+// Visibilidad de los usuarios borrados (soft delete) en el listado: deleted=only|include.
+// Por defecto se excluyen, igual que hace GORM con la columna deleted.
+
+import "strings"
+
+const (
+	DeletedExclude = ""
+	DeletedInclude = "include"
+	DeletedOnly    = "only"
+)
+
+func ParseDeleted(s string) (string, error) {
+	switch s = strings.ToLower(strings.TrimSpace(s)); s {
+	case DeletedExclude, DeletedInclude, DeletedOnly:
+		return s, nil
+	}
+	return "", ErrInvalidDeletedFilter{s}
+}
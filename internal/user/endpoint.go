@@ -8,7 +8,12 @@ package user
 import (
 	"context"
 	"errors"
+	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/juanjoaquin/back-g-domain/domain"
 	"github.com/juanjoaquin/back-g-meta/pkg/meta"
 	"github.com/juanjoaquin/back-g-response/response"
 )
@@ -19,11 +24,18 @@ type (
 
 	Endpoints struct {
 		// Aqui definimos los endpoints:
-		Create Controller
-		Get    Controller
-		GetAll Controller
-		Update Controller
-		Delete Controller
+		Create     Controller
+		BulkCreate Controller
+		Import     Controller
+		Get        Controller
+		GetAll     Controller
+		Export     Controller
+		Update     Controller
+		Replace    Controller
+		BulkUpdate Controller
+		Delete     Controller
+		Restore    Controller
+		BulkDelete Controller
 	}
 
 	/* 	4. Vamos a definir nuestro request para arrancar.
@@ -38,19 +50,104 @@ type (
 		Phone     string `json:"phone"`
 	}
 
+	// Alta masiva: el body es un array de CreateReq
+	BulkCreateReq struct {
+		Users []CreateReq
+	}
+
+	// Resultado de cada item del alta masiva, en el mismo orden que vino en el request
+	BulkItemResult struct {
+		Index  int    `json:"index"`
+		Status string `json:"status"` // created | error
+		ID     string `json:"id,omitempty"`
+		ItemError
+	}
+
+	// PUT: reemplaza el usuario completo. Los campos opcionales que no vienen quedan vacios
+	ReplaceReq struct {
+		ID        string `json:"-"`
+		IfMatch   string `json:"-"` // Header If-Match
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Email     string `json:"email"`
+		Phone     string `json:"phone"`
+	}
+
+	// Import de CSV. El handler ya mapeo las columnas del header a los campos del CreateReq
+	ImportReq struct {
+		DryRun bool
+		Rows   []ImportRow
+	}
+
+	ImportRow struct {
+		Line int // Linea del archivo, para que el reporte sea facil de seguir en la planilla
+		User CreateReq
+	}
+
+	ImportRowResult struct {
+		Line   int    `json:"line"`
+		Status string `json:"status"` // created | valid (dry run) | skipped | failed
+		ID     string `json:"id,omitempty"`
+		ItemError
+	}
+
+	ImportReport struct {
+		DryRun  bool              `json:"dry_run"`
+		Total   int               `json:"total"`
+		Created int               `json:"created"`
+		Valid   int               `json:"valid"`
+		Skipped int               `json:"skipped"`
+		Failed  int               `json:"failed"`
+		Rows    []ImportRowResult `json:"rows"`
+	}
+
+	// Modificacion masiva: se aplica a los usuarios que coinciden con los filtros (ids y/o filter del body)
+	BulkUpdateReq struct {
+		Filters   Filters
+		FirstName *string
+		LastName  *string
+		Email     *string
+		Phone     *string
+	}
+
+	// Baja masiva: los filtros vienen por query params (ej: ?ids=a,b,c)
+	BulkDeleteReq struct {
+		Filters Filters
+	}
+
+	ExportReq struct {
+		Format  string // csv | ndjson
+		Filters Filters
+	}
+
+	// El export no arma el body en el endpoint: el encoder va escribiendo cada lote que devuelve Each
+	Export struct {
+		Format string
+		Each   func(fn func(users []User) error) error
+	}
+
 	GetReq struct {
-		ID string
+		ID     string
+		Fields []string // Sparse fieldset, si viene vacio devolvemos el User completo
 	}
 
 	DeleteReq struct {
+		ID      string
+		IfMatch string // Header If-Match
+		Purge   bool   // purge=true borra el registro definitivamente
+	}
+
+	RestoreReq struct {
 		ID string
 	}
 
 	GetAllReq struct {
-		FirstName string
-		LastName  string
-		Limit     int
-		Page      int
+		Filters Filters // Los filtros los arma el handler desde los query params
+		Limit   int
+		Page    int
+		Cursor  *string // Si viene (aunque sea vacio) usamos la paginacion por cursor en vez de page/limit
+		Sort    []SortField
+		Fields  []string // Sparse fieldset, si viene vacio devolvemos los User completos
 	}
 	/*
 		5. Vamos a generar un struct para los errores de las response:
@@ -64,10 +161,12 @@ type (
 
 	UpdateReq struct {
 		ID        string
-		FirstName *string `json:"first_name"`
-		LastName  *string `json:"last_name"`
-		Email     *string `json:"email"`
-		Phone     *string `json:"phone"`
+		IfMatch   string    `json:"-"` // Header If-Match
+		Ops       []PatchOp `json:"-"` // Operaciones JSON Patch (application/json-patch+json)
+		FirstName *string   `json:"first_name"`
+		LastName  *string   `json:"last_name"`
+		Email     *string   `json:"email"`
+		Phone     *string   `json:"phone"`
 	}
 
 	/* Struct de Response general */
@@ -80,10 +179,31 @@ type (
 	}
 
 	Config struct {
-		LimPageDef string
+		LimPageDef  string
+		AllowUpsert bool // Si es true, el PUT crea el usuario con el id indicado cuando no existe
+		// Si es true, PATCH/PUT/DELETE de un usuario exigen el header If-Match (428 si no viene)
+		RequireIfMatch bool
+		PhoneRegion    string // Pais por defecto de los telefonos sin codigo de pais (ej: AR)
 	}
 )
 
+const (
+	maxBulkItems = 1000 // Maximo de usuarios por request en el alta masiva, y de afectados en la modificacion y baja masiva
+
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+
+	bulkStatusCreated = "created"
+	bulkStatusError   = "error"
+
+	maxImportRows = 5000 // Maximo de filas por archivo en el import
+
+	importStatusCreated = "created"
+	importStatusValid   = "valid"
+	importStatusSkipped = "skipped"
+	importStatusFailed  = "failed"
+)
+
 // 3. Esta es la función de MakeEndpoints, que va a devolver una estructura de Edpoints. Estos son los que vamos a poder utilizar en nuestro dominio.
 
 // Ahora le pasaremos el Service. Este lo tendra como prop. También lo recibira todas las funciones que encapsula.
@@ -91,16 +211,23 @@ func MakeEndpoints(s Service, config Config) Endpoints {
 	// Returnamos los endpoints
 	return Endpoints{
 		// Debemos indicar que cada endpoint representa cada funcion
-		Create: makeCreateEndpoint(s),
-		GetAll: makeGetAllEndpoint(s, config),
-		Get:    makeGetEndpoint(s),
-		Update: makeUpdateEndpoint(s),
-		Delete: makeDeleteEndpoint(s),
+		Create:     makeCreateEndpoint(s, config),
+		BulkCreate: makeBulkCreateEndpoint(s, config),
+		Import:     makeImportEndpoint(s, config),
+		GetAll:     makeGetAllEndpoint(s, config),
+		Export:     makeExportEndpoint(s),
+		Get:        makeGetEndpoint(s),
+		Update:     makeUpdateEndpoint(s, config),
+		Replace:    makeReplaceEndpoint(s, config),
+		BulkUpdate: makeBulkUpdateEndpoint(s, config),
+		Delete:     makeDeleteEndpoint(s, config),
+		Restore:    makeRestoreEndpoint(s),
+		BulkDelete: makeBulkDeleteEndpoint(s),
 	}
 }
 
 // Estas seran una funcion privada, ya que empiezan con minuscula, porque el que vamos a usar es el de arriba
-func makeDeleteEndpoint(s Service) Controller {
+func makeDeleteEndpoint(s Service, config Config) Controller {
 	// Definimos la funcion del Controller, que seria la que esta arriba de todo del Controller
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		// Aqui ira nuestra logica del endpoint
@@ -115,13 +242,19 @@ func makeDeleteEndpoint(s Service) Controller {
 
 		req := request.(DeleteReq)
 
-		err := s.Delete(ctx, req.ID)
+		if config.RequireIfMatch && req.IfMatch == "" {
+			return nil, NewErrorResponse(ErrPreconditionRequired, http.StatusPreconditionRequired)
+		}
+
+		var err error
+		if req.Purge {
+			err = s.Purge(ctx, req.ID, parseIfMatch(req.IfMatch))
+		} else {
+			err = s.Delete(ctx, req.ID, parseIfMatch(req.IfMatch))
+		}
 		// Nos traemos el service.Delete y handleamos el error (CON LA NUEVA STRUCT)
 		if err != nil {
-			if errors.As(err, &ErrUserNotFound{}) {
-				return nil, response.NotFound(err.Error())
-			}
-			return nil, response.InternalServerError(err.Error())
+			return nil, NewErrorResponse(err, ErrorStatus(err))
 
 		}
 
@@ -129,9 +262,23 @@ func makeDeleteEndpoint(s Service) Controller {
 	}
 }
 
+// Restore Endpoint. Deshace un borrado (soft delete), por ejemplo uno hecho por error desde soporte
+func makeRestoreEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(RestoreReq)
+
+		user, err := s.Restore(ctx, req.ID)
+		if err != nil {
+			return nil, NewErrorResponse(err, ErrorStatus(err))
+		}
+
+		return response.OK("success", user, nil), nil
+	}
+}
+
 // Create Endpoint
 // Aqui tambien le pasaremos ese servicio
-func makeCreateEndpoint(s Service) Controller {
+func makeCreateEndpoint(s Service, config Config) Controller {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 
 		// Asignamos el nuevo valor con el Go Kit del Request del Context
@@ -157,17 +304,13 @@ func makeCreateEndpoint(s Service) Controller {
 		*/
 
 		//Esta es el nuevo tipo de validacion con nuestro Package. Especificamos cual es el tipo de error
-		if req.FirstName == "" {
-			return nil, response.BadRequest(ErrFirstNameRequired.Error()) // Le pasamos el nuevo error.go junto al Package de Response
-		}
-
-		if req.LastName == "" {
-			return nil, response.BadRequest(ErrLastNameRequired.Error())
+		if err := validateCreateReq(req, config.PhoneRegion); err != nil {
+			return nil, NewErrorResponse(err, http.StatusBadRequest) // Le pasamos el nuevo error.go junto al Package de Response
 		}
 
 		user, err := s.Create(ctx, req.FirstName, req.LastName, req.Email, req.Phone) // Le pasamos el Context (ctx)
 		if err != nil {
-			return nil, response.InternalServerError(err.Error())
+			return nil, NewErrorResponse(err, ErrorStatus(err))
 		}
 
 		// Y aqui no lo usamos mas.
@@ -178,6 +321,155 @@ func makeCreateEndpoint(s Service) Controller {
 	}
 }
 
+// Bulk Create Endpoint
+// Validamos cada item con las mismas reglas del Create, insertamos los validos en lotes y devolvemos el estado de cada uno
+func makeBulkCreateEndpoint(s Service, config Config) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(BulkCreateReq)
+
+		if len(req.Users) == 0 {
+			return nil, NewErrorResponse(ErrBulkEmpty, http.StatusBadRequest)
+		}
+
+		if len(req.Users) > maxBulkItems {
+			return nil, NewErrorResponse(ErrBulkTooLarge, http.StatusBadRequest)
+		}
+
+		results := make([]BulkItemResult, len(req.Users))
+		var users []*domain.User
+		var indexes []int // Posicion en el request de cada usuario valido
+
+		for i, item := range req.Users {
+			results[i] = BulkItemResult{Index: i}
+			if err := validateCreateReq(item, config.PhoneRegion); err != nil {
+				results[i].Status = bulkStatusError
+				results[i].ItemError = newItemError(err)
+				continue
+			}
+
+			users = append(users, &domain.User{
+				FirstName: item.FirstName,
+				LastName:  item.LastName,
+				Email:     item.Email,
+				Phone:     item.Phone,
+			})
+			indexes = append(indexes, i)
+		}
+
+		errs := s.CreateMany(ctx, users)
+		for j, i := range indexes {
+			if errs[j] != nil {
+				results[i].Status = bulkStatusError
+				results[i].ItemError = newItemError(errs[j])
+				continue
+			}
+			results[i].Status = bulkStatusCreated
+			results[i].ID = users[j].ID
+		}
+
+		return response.OK("success", results, nil), nil
+	}
+}
+
+// Import Endpoint. Valida cada fila con las mismas reglas del Create. Con dry run solo valida, no crea nada
+func makeImportEndpoint(s Service, config Config) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ImportReq)
+
+		if len(req.Rows) > maxImportRows {
+			return nil, NewErrorResponse(ErrImportTooLarge, http.StatusBadRequest)
+		}
+
+		report := ImportReport{DryRun: req.DryRun, Total: len(req.Rows), Rows: make([]ImportRowResult, len(req.Rows))}
+		var candidates []int // Filas que pasaron la validacion
+		var emails []string  // Emails de esas filas, para buscar los que ya existen
+		seen := map[string]bool{}
+
+		fail := func(result *ImportRowResult, err error) {
+			result.Status = importStatusFailed
+			result.ItemError = newItemError(err)
+			report.Failed++
+		}
+
+		for i, row := range req.Rows {
+			result := &report.Rows[i]
+			result.Line = row.Line
+
+			// Las filas vacias (muy comunes al final de las planillas) las salteamos
+			if row.User == (CreateReq{}) {
+				result.Status = importStatusSkipped
+				report.Skipped++
+				continue
+			}
+
+			if err := validateCreateReq(row.User, config.PhoneRegion); err != nil {
+				fail(result, err)
+				continue
+			}
+
+			// Un email repetido dentro del mismo archivo: la primera fila gana, igual que en el INSERT
+			if email := NormalizeEmail(row.User.Email); email != "" {
+				if seen[email] {
+					fail(result, ErrEmailAlreadyExists{email})
+					continue
+				}
+				seen[email] = true
+				emails = append(emails, email)
+			}
+
+			candidates = append(candidates, i)
+		}
+
+		// Chequeamos los emails contra la DB tambien en el dry run, si no el reporte dice valid y el import real falla
+		inUse, err := s.EmailsInUse(ctx, emails)
+		if err != nil {
+			return nil, NewErrorResponse(err, ErrorStatus(err))
+		}
+
+		var users []*domain.User
+		var indexes []int // Posicion en el reporte de cada fila que vamos a insertar
+
+		for _, i := range candidates {
+			row, result := req.Rows[i], &report.Rows[i]
+
+			if email := NormalizeEmail(row.User.Email); inUse[email] {
+				fail(result, ErrEmailAlreadyExists{email})
+				continue
+			}
+
+			if req.DryRun {
+				result.Status = importStatusValid
+				report.Valid++
+				continue
+			}
+
+			users = append(users, &domain.User{
+				FirstName: row.User.FirstName,
+				LastName:  row.User.LastName,
+				Email:     row.User.Email,
+				Phone:     row.User.Phone,
+			})
+			indexes = append(indexes, i)
+		}
+
+		// Insertamos igual que el alta masiva (por lotes)
+		errs := s.CreateMany(ctx, users)
+		for j, i := range indexes {
+			if errs[j] != nil {
+				report.Rows[i].Status = importStatusFailed
+				report.Rows[i].ItemError = newItemError(errs[j])
+				report.Failed++
+				continue
+			}
+			report.Rows[i].Status = importStatusCreated
+			report.Rows[i].ID = users[j].ID
+			report.Created++
+		}
+
+		return response.OK("success", report, nil), nil
+	}
+}
+
 // Get All Endpoint
 func makeGetAllEndpoint(s Service, config Config) Controller {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
@@ -189,9 +481,20 @@ func makeGetAllEndpoint(s Service, config Config) Controller {
 		// v := re.URL.Query()
 
 		// Nos traemos el SearchParams, la Struct del Service.
-		filters := Filters{
-			FirstName: req.FirstName,
-			LastName:  req.LastName,
+		// Son los mismos filtros para el Count y el GetAll, asi el total y la pagina siempre coinciden
+		filters := req.Filters
+
+		if hasRelevanceSort(req.Sort) && filters.Search == "" {
+			return nil, NewErrorResponse(ErrRelevanceWithoutSearch, http.StatusBadRequest)
+		}
+
+		// Modo cursor: no usamos el Count ni el Meta, solo el next_cursor
+		if req.Cursor != nil {
+			// El cursor depende del orden created_at + id, no se puede combinar con otro orden
+			if len(req.Sort) > 0 {
+				return nil, NewErrorResponse(ErrSortWithCursor, http.StatusBadRequest)
+			}
+			return getAllByCursor(ctx, s, config, req)
 		}
 
 		// Nos traemos el Limit y el Page desde las ENV.
@@ -201,26 +504,79 @@ func makeGetAllEndpoint(s Service, config Config) Controller {
 		// Aqui aplicamos el Counter que hicimos despues de todo esto
 		count, err := s.Count(ctx, filters)
 		if err != nil {
-			return nil, response.InternalServerError(err.Error())
+			return nil, NewErrorResponse(err, ErrorStatus(err))
 		}
 		// Nos traemos el Package de Meta de la función New del propio package
 		meta, err := meta.New(req.Page, req.Limit, count, config.LimPageDef) // Le debemos pasar tanto Page & Limit
 
 		if err != nil {
-			return nil, response.InternalServerError(err.Error())
+			return nil, NewErrorResponse(err, ErrorStatus(err))
 
 		}
 
 		// Debemos hacer referencia al GetAll del Service
-		users, err := s.GetAll(ctx, filters, meta.Offset(), meta.Limit()) // Pasamos el filtro al GetAll del Service. Y tambien el Meta de Offset y Limit
+		users, err := s.GetAll(ctx, filters, req.Sort, req.Fields, meta.Offset(), meta.Limit()) // Pasamos el filtro al GetAll del Service. Y tambien el Meta de Offset y Limit
 
 		// Si el error es != nill, manejamos con el w.WirteHeader la Bad Request
 		if err != nil {
-			return nil, response.InternalServerError(err.Error())
+			return nil, NewErrorResponse(err, ErrorStatus(err))
 
 		}
 		// Lo devolvemos con la nueva struct de Response & Devolvemos el package de Meta (previamente traido arriba)
-		return response.OK("success", users, nil), nil
+		// El handler usa este Meta para armar los headers Link y X-Total-Count
+		return response.OK("success", pickUsersFields(users, req.Fields), meta), nil
+	}
+}
+
+// Paginacion por keyset. Pedimos un registro de mas para saber si hay una pagina siguiente
+func getAllByCursor(ctx context.Context, s Service, config Config, req GetAllReq) (interface{}, error) {
+	cursor, err := decodeCursor(*req.Cursor)
+	if err != nil {
+		return nil, NewErrorResponse(err, http.StatusBadRequest)
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit, err = strconv.Atoi(config.LimPageDef)
+		if err != nil {
+			return nil, NewErrorResponse(err, ErrorStatus(err))
+		}
+	}
+
+	users, err := s.GetAllAfter(ctx, req.Filters, cursor, req.Fields, limit+1)
+	if err != nil {
+		return nil, NewErrorResponse(err, ErrorStatus(err))
+	}
+
+	var page CursorPage
+	if len(users) > limit {
+		users = users[:limit]
+		page.NextCursor = encodeCursor(users[limit-1])
+	}
+	page.Users = pickUsersFields(users, req.Fields)
+
+	return response.OK("success", page, nil), nil
+}
+
+// Export Endpoint. Solo valida el formato, el recorrido de la tabla lo hace el encoder mientras escribe
+func makeExportEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ExportReq)
+
+		if req.Format == "" {
+			req.Format = ExportCSV
+		}
+
+		if req.Format != ExportCSV && req.Format != ExportNDJSON {
+			return nil, NewErrorResponse(ErrInvalidExportFormat{req.Format}, http.StatusBadRequest)
+		}
+
+		return Export{
+			Format: req.Format,
+			Each: func(fn func(users []User) error) error {
+				return s.Export(ctx, req.Filters, fn)
+			},
+		}, nil
 	}
 }
 
@@ -237,13 +593,15 @@ func makeGetEndpoint(s Service) Controller {
 		// NUEVO: Hay que hacer un Request de la Capa anterior de los Request
 		req := request.(GetReq)
 
-		user, err := s.Get(ctx, req.ID) // Declaramos al user, y llamamos al service ( s.Get() )
+		user, err := s.Get(ctx, req.ID, req.Fields) // Declaramos al user, y llamamos al service ( s.Get() )
 
 		if err != nil {
-			if errors.As(err, &ErrUserNotFound{}) {
-				return nil, response.NotFound(err.Error())
-			}
-			return nil, response.InternalServerError(err.Error())
+			return nil, NewErrorResponse(err, ErrorStatus(err))
+		}
+
+		// Si pidieron solo algunos campos, devolvemos solo esos
+		if len(req.Fields) > 0 {
+			return response.OK("success", pickFields(*user, req.Fields), nil), nil
 		}
 
 		return response.OK("success", user, nil), nil
@@ -251,27 +609,29 @@ func makeGetEndpoint(s Service) Controller {
 	}
 }
 
-func makeUpdateEndpoint(s Service) Controller {
+func makeUpdateEndpoint(s Service, config Config) Controller {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 
 		req := request.(UpdateReq)
 
-		// Validaciones
-		if req.FirstName != nil && *req.FirstName == "" {
-			return nil, response.BadRequest(ErrFirstNameRequired.Error())
+		if config.RequireIfMatch && req.IfMatch == "" {
+			return nil, NewErrorResponse(ErrPreconditionRequired, http.StatusPreconditionRequired)
+		}
+
+		// Con JSON Patch primero hay que leer el usuario para aplicarle las operaciones
+		if req.Ops != nil {
+			return patchUser(ctx, s, config, req)
 		}
 
-		if req.LastName != nil && *req.LastName == "" {
-			return nil, response.BadRequest(ErrLastNameRequired.Error())
+		// Validaciones
+		if err := validateUpdateReq(req.FirstName, req.LastName, req.Email, req.Phone, config.PhoneRegion); err != nil {
+			return nil, NewErrorResponse(err, http.StatusBadRequest)
 		}
 
 		// 👇 NUEVO: Recibe el usuario actualizado
-		user, err := s.Update(ctx, req.ID, req.FirstName, req.LastName, req.Email, req.Phone)
+		user, err := s.Update(ctx, req.ID, req.FirstName, req.LastName, req.Email, req.Phone, parseIfMatch(req.IfMatch))
 		if err != nil {
-			if errors.As(err, &ErrUserNotFound{}) {
-				return nil, response.NotFound(err.Error())
-			}
-			return nil, response.InternalServerError(err.Error())
+			return nil, NewErrorResponse(err, ErrorStatus(err))
 		}
 
 		// 👇 NUEVO: Devuelve el usuario en data
@@ -279,3 +639,134 @@ func makeUpdateEndpoint(s Service) Controller {
 	}
 }
 
+// JSON Patch: leemos el usuario, aplicamos las operaciones y guardamos solo lo que cambio.
+// El Update va con la version que leimos, asi si alguien lo modifica en el medio devolvemos 412
+func patchUser(ctx context.Context, s Service, config Config, req UpdateReq) (interface{}, error) {
+	current, err := s.Get(ctx, req.ID, nil)
+	if err != nil {
+		return nil, NewErrorResponse(err, ErrorStatus(err))
+	}
+
+	if !parseIfMatch(req.IfMatch).matches(&current.User) {
+		return nil, NewErrorResponse(ErrPreconditionFailed, http.StatusPreconditionFailed)
+	}
+
+	firstName, lastName, email, phone, err := applyJSONPatch(&current.User, req.Ops)
+	if err != nil {
+		if errors.Is(err, ErrPatchTestFailed) {
+			return nil, NewErrorResponse(err, http.StatusConflict)
+		}
+		return nil, NewErrorResponse(err, http.StatusBadRequest)
+	}
+
+	if err := validateUpdateReq(firstName, lastName, email, phone, config.PhoneRegion); err != nil {
+		return nil, NewErrorResponse(err, http.StatusBadRequest)
+	}
+
+	// Si las operaciones no cambiaron nada (ej: solo test) devolvemos el usuario tal cual
+	if firstName == nil && lastName == nil && email == nil && phone == nil {
+		return response.OK("success", current, nil), nil
+	}
+
+	var pre *Precondition
+	if current.UpdatedAt != nil {
+		pre = &Precondition{Versions: []time.Time{*current.UpdatedAt}}
+	}
+
+	user, err := s.Update(ctx, req.ID, firstName, lastName, email, phone, pre)
+	if err != nil {
+		return nil, NewErrorResponse(err, ErrorStatus(err))
+	}
+
+	return response.OK("success", user, nil), nil
+}
+
+// Replace Endpoint (PUT). Valida igual que el Create porque se manda el recurso completo
+func makeReplaceEndpoint(s Service, config Config) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ReplaceReq)
+
+		createReq := CreateReq{FirstName: req.FirstName, LastName: req.LastName, Email: req.Email, Phone: req.Phone}
+		if err := validateCreateReq(createReq, config.PhoneRegion); err != nil {
+			return nil, NewErrorResponse(err, http.StatusBadRequest)
+		}
+
+		if config.RequireIfMatch && req.IfMatch == "" {
+			return nil, NewErrorResponse(ErrPreconditionRequired, http.StatusPreconditionRequired)
+		}
+
+		// Con If-Match el cliente espera que el usuario ya exista, asi que no lo creamos
+		upsert := config.AllowUpsert && req.IfMatch == ""
+
+		// Si lo podemos llegar a crear, el id tiene que ser un UUID como los que genera el dominio
+		if upsert {
+			if _, err := uuid.Parse(req.ID); err != nil {
+				return nil, NewErrorResponse(ErrInvalidUserID{req.ID}, http.StatusBadRequest)
+			}
+		}
+
+		user := &domain.User{
+			ID:        req.ID,
+			FirstName: req.FirstName,
+			LastName:  req.LastName,
+			Email:     req.Email,
+			Phone:     req.Phone,
+		}
+
+		replaced, created, err := s.Replace(ctx, user, upsert, parseIfMatch(req.IfMatch))
+		if err != nil {
+			return nil, NewErrorResponse(err, ErrorStatus(err))
+		}
+
+		if created {
+			return response.Created("success", replaced, nil), nil
+		}
+
+		return response.OK("success", replaced, nil), nil
+	}
+}
+
+// Bulk Update Endpoint. Todo se aplica en una sola transaccion
+func makeBulkUpdateEndpoint(s Service, config Config) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(BulkUpdateReq)
+
+		// Nunca dejamos modificar toda la tabla por no mandar filtros
+		if req.Filters.isEmpty() {
+			return nil, NewErrorResponse(ErrBulkNoCriteria, http.StatusBadRequest)
+		}
+
+		if req.FirstName == nil && req.LastName == nil && req.Email == nil && req.Phone == nil {
+			return nil, NewErrorResponse(ErrNoFieldsToUpdate, http.StatusBadRequest)
+		}
+
+		if err := validateUpdateReq(req.FirstName, req.LastName, req.Email, req.Phone, config.PhoneRegion); err != nil {
+			return nil, NewErrorResponse(err, http.StatusBadRequest)
+		}
+
+		result, err := s.UpdateMany(ctx, req.Filters, req.FirstName, req.LastName, req.Email, req.Phone)
+		if err != nil {
+			return nil, NewErrorResponse(err, ErrorStatus(err))
+		}
+
+		return response.OK("success", result, nil), nil
+	}
+}
+
+// Bulk Delete Endpoint. Todo se aplica en una sola transaccion
+func makeBulkDeleteEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(BulkDeleteReq)
+
+		if req.Filters.isEmpty() {
+			return nil, NewErrorResponse(ErrBulkNoCriteria, http.StatusBadRequest)
+		}
+
+		result, err := s.DeleteMany(ctx, req.Filters)
+		if err != nil {
+			return nil, NewErrorResponse(err, ErrorStatus(err))
+		}
+
+		return response.OK("success", result, nil), nil
+	}
+}
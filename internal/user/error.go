@@ -1,14 +1,31 @@
 package user
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/juanjoaquin/back-g-response/response"
 )
 
 // Este archivo son los errores customizados para los campos. Por ejemplo: First Name, Last Name del User, etc...
 
 var ErrFirstNameRequired = errors.New("First Name is required")
 var ErrLastNameRequired = errors.New("Last Name is required")
+var ErrInvalidCursor = errors.New("invalid cursor")
+var ErrSortWithCursor = errors.New("sort is not supported with cursor pagination")
+var ErrBulkEmpty = errors.New("at least one user is required")
+var ErrBulkTooLarge = errors.New("too many users in a single request")
+var ErrBulkNoCriteria = errors.New("ids or filter are required")
+var ErrNoFieldsToUpdate = errors.New("at least one field to update is required")
+var ErrPreconditionFailed = errors.New("user was modified by another request")
+var ErrPreconditionRequired = errors.New("If-Match header is required")
+var ErrPatchTestFailed = errors.New("patch test operation failed")
+var ErrImportTooLarge = errors.New("too many rows in the file")
+var ErrRelevanceWithoutSearch = errors.New("sort by relevance requires the q parameter")
 
 // Manejo de Errores con Parametros Dinamicos
 type ErrUserNotFound struct {
@@ -18,3 +35,254 @@ type ErrUserNotFound struct {
 func (e ErrUserNotFound) Error() string {
 	return fmt.Sprintf("user '%s' doesnt exists", e.UserID)
 }
+
+type ErrInvalidSortField struct {
+	Field string
+}
+
+func (e ErrInvalidSortField) Error() string {
+	return fmt.Sprintf("sort field '%s' is not allowed", e.Field)
+}
+
+type ErrInvalidField struct {
+	Field string
+}
+
+func (e ErrInvalidField) Error() string {
+	return fmt.Sprintf("field '%s' is not allowed", e.Field)
+}
+
+type ErrInvalidUserID struct {
+	UserID string
+}
+
+func (e ErrInvalidUserID) Error() string {
+	return fmt.Sprintf("user id '%s' is not a valid uuid", e.UserID)
+}
+
+type ErrInvalidPatchOp struct {
+	Op   string
+	Path string
+}
+
+func (e ErrInvalidPatchOp) Error() string {
+	return fmt.Sprintf("invalid patch operation '%s' on path '%s'", e.Op, e.Path)
+}
+
+type ErrInvalidExportFormat struct {
+	Format string
+}
+
+func (e ErrInvalidExportFormat) Error() string {
+	return fmt.Sprintf("export format '%s' is not supported", e.Format)
+}
+
+type ErrEmailAlreadyExists struct {
+	Email string
+}
+
+func (e ErrEmailAlreadyExists) Error() string {
+	return fmt.Sprintf("email '%s' already exists", e.Email)
+}
+
+type ErrInvalidDeletedFilter struct {
+	Value string
+}
+
+func (e ErrInvalidDeletedFilter) Error() string {
+	return fmt.Sprintf("deleted filter '%s' is not valid, use 'only' or 'include'", e.Value)
+}
+
+type ErrUserNotDeleted struct {
+	UserID string
+}
+
+func (e ErrUserNotDeleted) Error() string {
+	return fmt.Sprintf("user '%s' is not deleted", e.UserID)
+}
+
+// Respuesta de error. En JSON se ve igual que las del package response (message, status, data),
+// pero ademas lleva un codigo estable. Con el codigo el handler arma el problem+json (RFC 7807) y traduce el mensaje
+type ErrorResponse struct {
+	Message   string                `json:"message"`
+	Status    int                   `json:"status"`
+	Data      interface{}           `json:"data"`
+	Code      string                `json:"code"`                 // Codigo estable del error (ej: user-not-found)
+	Fields    map[string]FieldError `json:"errors,omitempty"`     // Errores por campo (ej: first_name => first-name-required)
+	Params    map[string]string     `json:"-"`                    // Valores para armar el mensaje traducido (ej: user_id)
+	RequestID string                `json:"request_id,omitempty"` // Id del request, para buscarlo en los logs
+}
+
+func (e *ErrorResponse) StatusCode() int {
+	return e.Status
+}
+
+func (e *ErrorResponse) GetBody() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func (e *ErrorResponse) Error() string {
+	return e.Message
+}
+
+func (e *ErrorResponse) GetData() interface{} {
+	return nil
+}
+
+// Armamos la respuesta de error con el codigo que le corresponde al error
+func NewErrorResponse(err error, status int) response.Response {
+	resp := &ErrorResponse{
+		Message: err.Error(),
+		Status:  status,
+		Code:    ErrorCode(err, status),
+		Params:  errorParams(err),
+	}
+
+	var v *ValidationError
+	if errors.As(err, &v) {
+		resp.Fields = v.FieldErrors()
+	}
+
+	return resp
+}
+
+// Error de un item de las operaciones masivas (alta masiva e import). Lleva el codigo y los errores por campo
+// igual que ErrorResponse, asi el handler tambien lo traduce segun el Accept-Language
+type ItemError struct {
+	Error  string                `json:"error,omitempty"`
+	Code   string                `json:"code,omitempty"`
+	Errors map[string]FieldError `json:"errors,omitempty"`
+	Params map[string]string     `json:"-"`
+}
+
+func newItemError(err error) ItemError {
+	resp := NewErrorResponse(err, ErrorStatus(err)).(*ErrorResponse)
+	return ItemError{Error: resp.Message, Code: resp.Code, Errors: resp.Fields, Params: resp.Params}
+}
+
+// Valores de los errores con parametros, con el mismo nombre que usan los catalogos de mensajes
+func errorParams(err error) map[string]string {
+	// Si fallo un solo campo el error toma el codigo de ese campo, asi que tambien sus valores
+	var v *ValidationError
+	if errors.As(err, &v) {
+		if field, ok := v.single(); ok {
+			return errorParams(field)
+		}
+		return nil
+	}
+
+	var (
+		notFound      ErrUserNotFound
+		notDeleted    ErrUserNotDeleted
+		emailExists   ErrEmailAlreadyExists
+		sortField     ErrInvalidSortField
+		field         ErrInvalidField
+		userID        ErrInvalidUserID
+		patchOp       ErrInvalidPatchOp
+		exportFormat  ErrInvalidExportFormat
+		deletedFilter ErrInvalidDeletedFilter
+		tooLong       ErrFieldTooLong
+		format        ErrInvalidFormat
+	)
+
+	switch {
+	case errors.As(err, &notFound):
+		return map[string]string{"user_id": notFound.UserID}
+	case errors.As(err, &notDeleted):
+		return map[string]string{"user_id": notDeleted.UserID}
+	case errors.As(err, &emailExists):
+		return map[string]string{"email": emailExists.Email}
+	case errors.As(err, &sortField):
+		return map[string]string{"field": sortField.Field}
+	case errors.As(err, &field):
+		return map[string]string{"field": field.Field}
+	case errors.As(err, &userID):
+		return map[string]string{"user_id": userID.UserID}
+	case errors.As(err, &patchOp):
+		return map[string]string{"op": patchOp.Op, "path": patchOp.Path}
+	case errors.As(err, &exportFormat):
+		return map[string]string{"format": exportFormat.Format}
+	case errors.As(err, &deletedFilter):
+		return map[string]string{"value": deletedFilter.Value}
+	case errors.As(err, &tooLong):
+		return map[string]string{"field": tooLong.Field, "max": strconv.Itoa(tooLong.Max)}
+	case errors.As(err, &format):
+		return map[string]string{"field": format.Field}
+	}
+
+	return nil
+}
+
+// Codigos de los errores. No se deben cambiar, el API gateway rutea con ellos
+var errorCodes = map[error]string{
+	ErrFirstNameRequired:      "first-name-required",
+	ErrLastNameRequired:       "last-name-required",
+	ErrInvalidCursor:          "invalid-cursor",
+	ErrSortWithCursor:         "sort-with-cursor",
+	ErrBulkEmpty:              "bulk-empty",
+	ErrBulkTooLarge:           "bulk-too-large",
+	ErrBulkNoCriteria:         "bulk-no-criteria",
+	ErrNoFieldsToUpdate:       "no-fields-to-update",
+	ErrPreconditionFailed:     "precondition-failed",
+	ErrPreconditionRequired:   "precondition-required",
+	ErrPatchTestFailed:        "patch-test-failed",
+	ErrImportTooLarge:         "import-too-large",
+	ErrRelevanceWithoutSearch: "relevance-without-search",
+}
+
+// Si el error no tiene un codigo propio usamos el del status HTTP (ej: internal-server-error)
+func ErrorCode(err error, status int) string {
+	// Primero el de validacion, porque envuelve a los errores de cada campo. Si fallo un solo campo
+	// devolvemos su codigo (ej: first-name-required), asi no cambian los codigos que ya usa el API gateway
+	var v *ValidationError
+	if errors.As(err, &v) {
+		if field, ok := v.single(); ok {
+			return ErrorCode(field, status)
+		}
+		return "validation-failed"
+	}
+
+	// Los errores de la DB usan la clase como codigo (ej: timeout, unavailable)
+	var store *StoreError
+	if errors.As(err, &store) && store.Kind != KindInternal {
+		return string(store.Kind)
+	}
+
+	for e, code := range errorCodes {
+		if errors.Is(err, e) {
+			return code
+		}
+	}
+
+	switch {
+	case errors.As(err, &ErrUserNotFound{}):
+		return "user-not-found"
+	case errors.As(err, &ErrUserNotDeleted{}):
+		return "user-not-deleted"
+	case errors.As(err, &ErrEmailAlreadyExists{}):
+		return "email-already-exists"
+	case errors.As(err, &ErrInvalidSortField{}):
+		return "invalid-sort-field"
+	case errors.As(err, &ErrInvalidField{}):
+		return "invalid-field"
+	case errors.As(err, &ErrInvalidUserID{}):
+		return "invalid-user-id"
+	case errors.As(err, &ErrInvalidPatchOp{}):
+		return "invalid-patch-op"
+	case errors.As(err, &ErrInvalidExportFormat{}):
+		return "invalid-export-format"
+	case errors.As(err, &ErrInvalidDeletedFilter{}):
+		return "invalid-deleted-filter"
+	case errors.As(err, &ErrFieldTooLong{}):
+		return "field-too-long"
+	case errors.As(err, &ErrInvalidFormat{}):
+		return "invalid-format"
+	}
+
+	return StatusCode(status)
+}
+
+// Codigo generico a partir del status HTTP: 404 => not-found
+func StatusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "-")
+}
@@ -0,0 +1,72 @@
+package user
+
+// Control de concurrencia optimista. El ETag de un usuario sale de su updated_at (en milisegundos),
+// asi el repositorio puede validar el If-Match directo en el WHERE del UPDATE/DELETE.
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juanjoaquin/back-g-domain/domain"
+)
+
+// Precondition es lo que mando el cliente en el If-Match. Nil significa sin condicion.
+// Versions son los updated_at aceptados; si esta vacio no coincide con ninguna version.
+type Precondition struct {
+	Versions []time.Time
+}
+
+// ETag devuelve el ETag fuerte del usuario, o "" si todavia no tiene updated_at
+func ETag(u *domain.User) string {
+	if u == nil || u.UpdatedAt == nil {
+		return ""
+	}
+	return `"` + strconv.FormatInt(u.UpdatedAt.UnixMilli(), 36) + `"`
+}
+
+// Parseamos el header If-Match. Los ETags debiles o que no generamos nosotros nunca coinciden.
+// "*" solo exige que el usuario exista, asi que no agrega condicion sobre la version
+func parseIfMatch(header string) *Precondition {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil
+	}
+
+	pre := &Precondition{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) || len(tag) < 2 {
+			continue
+		}
+
+		ms, err := strconv.ParseInt(strings.Trim(tag, `"`), 36, 64)
+		if err != nil {
+			continue
+		}
+		pre.Versions = append(pre.Versions, time.UnixMilli(ms))
+	}
+
+	return pre
+}
+
+// Chequeamos la precondicion contra un usuario ya leido (y bloqueado) dentro de una transaccion
+func (p *Precondition) matches(u *domain.User) bool {
+	if p == nil {
+		return true
+	}
+	if u.UpdatedAt == nil {
+		return false
+	}
+	for _, v := range p.Versions {
+		if v.Equal(u.UpdatedAt.Truncate(time.Millisecond)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Las fechas las guardamos en milisegundos, que es la precision del ETag
+func now() time.Time {
+	return time.Now().Truncate(time.Millisecond)
+}
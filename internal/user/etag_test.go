@@ -0,0 +1,83 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/juanjoaquin/back-g-domain/domain"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	v1 := time.UnixMilli(1700000000000)
+	v2 := time.UnixMilli(1700000000123)
+	tag1 := ETag(&domain.User{UpdatedAt: &v1})
+	tag2 := ETag(&domain.User{UpdatedAt: &v2})
+
+	tests := []struct {
+		name   string
+		header string
+		want   *Precondition // nil = sin condicion
+	}{
+		{name: "sin header", header: "", want: nil},
+		{name: "asterisco", header: "*", want: nil},
+		{name: "asterisco con espacios", header: " * ", want: nil},
+		{name: "un etag", header: tag1, want: &Precondition{Versions: []time.Time{v1}}},
+		{name: "lista de etags", header: tag1 + " , " + tag2, want: &Precondition{Versions: []time.Time{v1, v2}}},
+		{name: "etag debil", header: "W/" + tag1, want: &Precondition{}},
+		{name: "sin comillas", header: tag1[1 : len(tag1)-1], want: &Precondition{}},
+		{name: "comilla sola", header: `"`, want: &Precondition{}},
+		{name: "etag que no generamos", header: `"not-ours"`, want: &Precondition{}},
+		{name: "ignora los invalidos de la lista", header: `"not-ours", ` + tag2, want: &Precondition{Versions: []time.Time{v2}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseIfMatch(tt.header)
+
+			if tt.want == nil || got == nil {
+				if tt.want != got {
+					t.Fatalf("parseIfMatch(%q) = %+v, want %+v", tt.header, got, tt.want)
+				}
+				return
+			}
+
+			if len(got.Versions) != len(tt.want.Versions) {
+				t.Fatalf("parseIfMatch(%q) = %v, want %v", tt.header, got.Versions, tt.want.Versions)
+			}
+			for i := range got.Versions {
+				if !got.Versions[i].Equal(tt.want.Versions[i]) {
+					t.Errorf("version %d = %v, want %v", i, got.Versions[i], tt.want.Versions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPreconditionMatches(t *testing.T) {
+	// En la DB la fecha puede tener mas precision que el ETag (milisegundos)
+	updated := time.UnixMilli(1700000000000).Add(456 * time.Microsecond)
+	other := updated.Add(time.Second)
+	user := &domain.User{UpdatedAt: &updated}
+
+	tests := []struct {
+		name string
+		pre  *Precondition
+		user *domain.User
+		want bool
+	}{
+		{name: "sin condicion", pre: nil, user: user, want: true},
+		{name: "mismo etag", pre: parseIfMatch(ETag(user)), user: user, want: true},
+		{name: "alguno de la lista", pre: parseIfMatch(ETag(&domain.User{UpdatedAt: &other}) + ", " + ETag(user)), user: user, want: true},
+		{name: "otra version", pre: parseIfMatch(ETag(&domain.User{UpdatedAt: &other})), user: user, want: false},
+		{name: "sin versiones validas", pre: &Precondition{}, user: user, want: false},
+		{name: "usuario sin updated_at", pre: parseIfMatch(ETag(user)), user: &domain.User{}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pre.matches(tt.user); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
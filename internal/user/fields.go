@@ -0,0 +1,80 @@
+package user
+
+// Sparse fieldsets: el cliente puede pedir solo algunos campos (ej: fields=id,first_name,email).
+// El repositorio selecciona solo esas columnas y el endpoint devuelve solo esos atributos.
+
+import (
+	"strings"
+)
+
+// Whitelist: atributo del JSON => columna de la DB
+var selectableFields = map[string]string{
+	"id":            "id",
+	"first_name":    "first_name",
+	"last_name":     "last_name",
+	"email":         "email",
+	"phone":         "phone",
+	"phone_display": "phone_display",
+}
+
+// Devuelve nil si no se pidio ningun campo (se devuelve el User completo)
+func ParseFields(s string) ([]string, error) {
+	var fields []string
+	seen := make(map[string]bool)
+
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" || seen[f] {
+			continue
+		}
+
+		if _, ok := selectableFields[f]; !ok {
+			return nil, ErrInvalidField{f}
+		}
+
+		seen[f] = true
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+// Columnas a seleccionar en la DB. Los extra son columnas que necesitamos internamente (ej: el cursor)
+func selectColumns(fields []string, extra ...string) []string {
+	columns := make([]string, 0, len(fields)+len(extra))
+	for _, f := range fields {
+		columns = append(columns, selectableFields[f])
+	}
+	return append(columns, extra...)
+}
+
+// Armamos la respuesta solo con los atributos pedidos
+func pickFields(u User, fields []string) map[string]interface{} {
+	values := map[string]interface{}{
+		"id":            u.ID,
+		"first_name":    u.FirstName,
+		"last_name":     u.LastName,
+		"email":         u.Email,
+		"phone":         u.Phone,
+		"phone_display": u.PhoneDisplay,
+	}
+
+	picked := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		picked[f] = values[f]
+	}
+	return picked
+}
+
+// Si no se pidieron campos devolvemos los usuarios tal cual
+func pickUsersFields(users []User, fields []string) interface{} {
+	if len(fields) == 0 {
+		return users
+	}
+
+	picked := make([]map[string]interface{}, 0, len(users))
+	for _, u := range users {
+		picked = append(picked, pickFields(u, fields))
+	}
+	return picked
+}
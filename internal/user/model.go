@@ -0,0 +1,135 @@
+package user
+
+// El domain.User es compartido con los otros servicios, por eso las columnas propias de este servicio
+// las agregamos aca, embebiendo el User. GORM aplana el struct embebido, asi que es la misma tabla "users".
+
+import (
+	"github.com/juanjoaquin/back-g-domain/domain"
+	"gorm.io/gorm"
+)
+
+type userRow struct {
+	domain.User
+	// Columnas "sombra" con el nombre normalizado (ver Fold). Las mantiene el repositorio en el Create y el Update
+	FirstNameSearch string `gorm:"type:char(50)"`
+	LastNameSearch  string `gorm:"type:char(50)"`
+	// Email normalizado con indice unico. Es NULL si el usuario no tiene email, asi pueden haber varios sin email.
+	// Los borrados (soft delete) mantienen su email reservado para poder restaurarlos; el purge lo libera
+	EmailKey *string `gorm:"type:char(50);uniqueIndex"`
+	// El telefono como lo escribio el usuario. En phone queda normalizado en E.164 (ver NormalizePhone)
+	PhoneDisplay string `gorm:"type:char(30)"`
+}
+
+// User es el usuario que devuelve la API: el domain.User mas las columnas de este servicio que le mostramos al cliente
+type User struct {
+	domain.User
+	PhoneDisplay string `json:"phone_display"`
+}
+
+func (User) TableName() string {
+	return "users"
+}
+
+func (userRow) TableName() string {
+	return "users"
+}
+
+func newUserRow(u domain.User, phoneRegion string) userRow {
+	// Seteamos las fechas nosotros (en milisegundos) para que el ETag que devuelve el alta coincida con el de la DB
+	if u.CreatedAt == nil {
+		t := now()
+		u.CreatedAt, u.UpdatedAt = &t, &t
+	}
+
+	display := u.Phone
+	u.Phone = normalizePhone(u.Phone, phoneRegion)
+
+	return userRow{
+		User:            u,
+		FirstNameSearch: Fold(u.FirstName),
+		LastNameSearch:  Fold(u.LastName),
+		EmailKey:        emailKey(u.Email),
+		PhoneDisplay:    display,
+	}
+}
+
+func emailKey(email string) *string {
+	key := NormalizeEmail(email)
+	if key == "" {
+		return nil
+	}
+	return &key
+}
+
+// Migrate crea/actualiza la tabla de usuarios con las columnas de este servicio
+// y completa las columnas normalizadas de los registros que ya existian.
+// phoneRegion es el pais por defecto para normalizar los telefonos (ver NormalizePhone)
+func Migrate(db *gorm.DB, phoneRegion string) error {
+	if err := db.AutoMigrate(&userRow{}); err != nil {
+		return err
+	}
+
+	if err := backfillSearch(db); err != nil {
+		return err
+	}
+
+	if err := backfillEmailKey(db); err != nil {
+		return err
+	}
+
+	return backfillPhone(db, phoneRegion)
+}
+
+func backfillSearch(db *gorm.DB) error {
+	var rows []userRow
+	return db.Unscoped().Where("first_name_search IS NULL OR last_name_search IS NULL").
+		FindInBatches(&rows, 500, func(tx *gorm.DB, _ int) error {
+			for _, r := range rows {
+				err := tx.Model(&userRow{}).Unscoped().Where("id = ?", r.ID).UpdateColumns(map[string]interface{}{
+					"first_name_search": Fold(r.FirstName),
+					"last_name_search":  Fold(r.LastName),
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// Si ya habia emails repetidos, el primero se queda con el email y el resto queda sin email_key
+// (no se puede crear otro usuario con ese email, pero hay que corregir los repetidos a mano)
+func backfillEmailKey(db *gorm.DB) error {
+	var rows []userRow
+	return db.Unscoped().Where("email_key IS NULL AND email <> ''").
+		FindInBatches(&rows, 500, func(tx *gorm.DB, _ int) error {
+			for _, r := range rows {
+				err := tx.Model(&userRow{}).Unscoped().Where("id = ?", r.ID).UpdateColumns(map[string]interface{}{
+					"email":     NormalizeEmail(r.Email),
+					"email_key": emailKey(r.Email),
+				}).Error
+				if err != nil && !isDuplicateKey(err) {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// Los telefonos que ya existian pasan a E.164 y el valor original queda en phone_display
+func backfillPhone(db *gorm.DB, phoneRegion string) error {
+	var rows []userRow
+	return db.Unscoped().Where("phone_display IS NULL").
+		FindInBatches(&rows, 500, func(tx *gorm.DB, _ int) error {
+			for _, r := range rows {
+				err := tx.Model(&userRow{}).Unscoped().Where("id = ?", r.ID).UpdateColumns(map[string]interface{}{
+					"phone":         normalizePhone(r.Phone, phoneRegion),
+					"phone_display": r.Phone,
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
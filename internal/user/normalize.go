@@ -0,0 +1,40 @@
+package user
+
+// Normalizacion de texto para las busquedas por nombre.
+// Sacamos los acentos y pasamos a minuscula, asi "jose" encuentra a "José" y "Munoz" a "Muñoz".
+// Tambien la normalizacion del email, que se guarda siempre en minuscula.
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Fold devuelve el texto sin acentos y en minuscula.
+// Cualquier implementacion de Repository debe guardar y comparar los nombres con esta funcion,
+// ya que el service le pasa los filtros de nombre ya normalizados.
+func Fold(s string) string {
+	// Separamos cada letra de su acento (NFD), borramos los acentos (Mn) y volvemos a componer (NFC)
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+	return strings.ToLower(folded)
+}
+
+// El email se guarda sin espacios y en minuscula, asi no hay dos usuarios con el mismo email escrito distinto
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Normalizamos los filtros de texto libre que se comparan contra los nombres
+func (f Filters) folded() Filters {
+	f.FirstName = Fold(f.FirstName)
+	f.LastName = Fold(f.LastName)
+	f.Search = Fold(f.Search)
+	return f
+}
@@ -0,0 +1,56 @@
+package user
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"juan@mail.com", "juan@mail.com"},
+		{"  Juan.Perez@Mail.COM \t", "juan.perez@mail.com"},
+		{"JUAN+TAG@MAIL.COM", "juan+tag@mail.com"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeEmail(tt.email); got != tt.want {
+			t.Errorf("NormalizeEmail(%q) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestEmailValidation(t *testing.T) {
+	tests := []struct {
+		email string
+		valid bool
+	}{
+		{"juan@mail.com", true},
+		{"  JUAN@MAIL.COM  ", true}, // Se valida ya normalizado
+		{"juan.perez+tag@sub.mail.com.ar", true},
+		{"juan", false},
+		{"juan@", false},
+		{"@mail.com", false},
+		{"juan perez@mail.com", false},
+		{"Juan <juan@mail.com>", false},
+		{"juan@mail.com (trabajo)", false},
+		{"juan@@mail.com", false},
+	}
+
+	for _, tt := range tests {
+		err := validateUpdateReq(nil, nil, &tt.email, nil, "AR")
+		if (err == nil) != tt.valid {
+			t.Errorf("validate email %q: err = %v, want valid %v", tt.email, err, tt.valid)
+		}
+	}
+
+	long := strings.Repeat("a", maxEmailLength) + "@mail.com"
+	if code := ErrorCode(validateUpdateReq(nil, nil, &long, nil, "AR"), http.StatusBadRequest); code != "field-too-long" {
+		t.Errorf("long email code = %q, want field-too-long", code)
+	}
+}
@@ -0,0 +1,108 @@
+package user
+
+// JSON Patch (RFC 6902) sobre los campos editables del usuario.
+// Aplicamos las operaciones sobre una copia del usuario actual y devolvemos solo los campos que cambiaron,
+// asi despues lo guardamos con el mismo Update del PATCH comun.
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/juanjoaquin/back-g-domain/domain"
+)
+
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Campos que se pueden modificar con un patch (el id no)
+var patchableFields = []string{"first_name", "last_name", "email", "phone"}
+
+// Aplicamos las operaciones y devolvemos los campos modificados (nil = sin cambios) en el orden:
+// first_name, last_name, email, phone
+func applyJSONPatch(u *domain.User, ops []PatchOp) (firstName, lastName, email, phone *string, err error) {
+	doc := map[string]string{
+		"first_name": u.FirstName,
+		"last_name":  u.LastName,
+		"email":      u.Email,
+		"phone":      u.Phone,
+	}
+
+	for _, op := range ops {
+		field, ok := patchField(op.Path)
+		if !ok {
+			return nil, nil, nil, nil, ErrInvalidPatchOp{op.Op, op.Path}
+		}
+
+		switch op.Op {
+		case "add", "replace":
+			value, ok := patchValue(op.Value)
+			if !ok {
+				return nil, nil, nil, nil, ErrInvalidPatchOp{op.Op, op.Path}
+			}
+			doc[field] = value
+		case "remove":
+			// Sacar un campo es dejarlo vacio (para el nombre y el apellido falla la validacion)
+			doc[field] = ""
+		case "copy", "move":
+			from, ok := patchField(op.From)
+			if !ok {
+				return nil, nil, nil, nil, ErrInvalidPatchOp{op.Op, op.From}
+			}
+			doc[field] = doc[from]
+			if op.Op == "move" && from != field {
+				doc[from] = ""
+			}
+		case "test":
+			value, ok := patchValue(op.Value)
+			if !ok || doc[field] != value {
+				return nil, nil, nil, nil, ErrPatchTestFailed
+			}
+		default:
+			return nil, nil, nil, nil, ErrInvalidPatchOp{op.Op, op.Path}
+		}
+	}
+
+	return changed(u.FirstName, doc["first_name"]), changed(u.LastName, doc["last_name"]),
+		changed(u.Email, doc["email"]), changed(u.Phone, doc["phone"]), nil
+}
+
+// El path es un JSON Pointer de un solo nivel, ej: /first_name
+func patchField(path string) (string, bool) {
+	field := strings.TrimPrefix(path, "/")
+	if field == path {
+		return "", false
+	}
+	for _, f := range patchableFields {
+		if f == field {
+			return field, true
+		}
+	}
+	return "", false
+}
+
+// Los valores tienen que ser strings. El null lo tomamos como vacio
+func patchValue(raw json.RawMessage) (string, bool) {
+	if len(raw) == 0 {
+		return "", false
+	}
+
+	var value *string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", false
+	}
+	if value == nil {
+		return "", true
+	}
+	return *value, true
+}
+
+func changed(before, after string) *string {
+	if before == after {
+		return nil
+	}
+	return &after
+}
@@ -0,0 +1,149 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/juanjoaquin/back-g-domain/domain"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	current := domain.User{FirstName: "Juan", LastName: "Perez", Email: "juan@mail.com", Phone: "+541144445555"}
+
+	tests := []struct {
+		name string
+		ops  []PatchOp
+		// Valores esperados de los campos que cambian, nil = sin cambios
+		firstName, lastName, email, phone *string
+		err                               error
+	}{
+		{
+			name:      "replace",
+			ops:       []PatchOp{{Op: "replace", Path: "/first_name", Value: raw(`"Pedro"`)}},
+			firstName: str("Pedro"),
+		},
+		{
+			name: "replace con el mismo valor no cambia nada",
+			ops:  []PatchOp{{Op: "replace", Path: "/first_name", Value: raw(`"Juan"`)}},
+		},
+		{
+			name:     "test que coincide y despues replace",
+			ops:      []PatchOp{{Op: "test", Path: "/last_name", Value: raw(`"Perez"`)}, {Op: "replace", Path: "/last_name", Value: raw(`"Gomez"`)}},
+			lastName: str("Gomez"),
+		},
+		{
+			name: "test que no coincide",
+			ops:  []PatchOp{{Op: "test", Path: "/last_name", Value: raw(`"Gomez"`)}, {Op: "replace", Path: "/last_name", Value: raw(`"Lopez"`)}},
+			err:  ErrPatchTestFailed,
+		},
+		{
+			name: "test sin value",
+			ops:  []PatchOp{{Op: "test", Path: "/last_name"}},
+			err:  ErrPatchTestFailed,
+		},
+		{
+			name:  "test con null compara contra vacio",
+			ops:   []PatchOp{{Op: "remove", Path: "/email"}, {Op: "test", Path: "/email", Value: raw(`null`)}},
+			email: str(""),
+		},
+		{
+			name:  "remove deja el campo vacio",
+			ops:   []PatchOp{{Op: "remove", Path: "/phone"}},
+			phone: str(""),
+		},
+		{
+			name:     "copy",
+			ops:      []PatchOp{{Op: "copy", From: "/first_name", Path: "/last_name"}},
+			lastName: str("Juan"),
+		},
+		{
+			name:      "move vacia el origen",
+			ops:       []PatchOp{{Op: "move", From: "/last_name", Path: "/first_name"}},
+			firstName: str("Perez"),
+			lastName:  str(""),
+		},
+		{
+			name: "move al mismo campo no cambia nada",
+			ops:  []PatchOp{{Op: "move", From: "/email", Path: "/email"}},
+		},
+		{
+			name: "path que no se puede modificar",
+			ops:  []PatchOp{{Op: "replace", Path: "/id", Value: raw(`"x"`)}},
+			err:  ErrInvalidPatchOp{"replace", "/id"},
+		},
+		{
+			name: "path sin barra",
+			ops:  []PatchOp{{Op: "replace", Path: "first_name", Value: raw(`"x"`)}},
+			err:  ErrInvalidPatchOp{"replace", "first_name"},
+		},
+		{
+			name: "from invalido",
+			ops:  []PatchOp{{Op: "copy", From: "/password", Path: "/email"}},
+			err:  ErrInvalidPatchOp{"copy", "/password"},
+		},
+		{
+			name: "valor que no es string",
+			ops:  []PatchOp{{Op: "replace", Path: "/phone", Value: raw(`123`)}},
+			err:  ErrInvalidPatchOp{"replace", "/phone"},
+		},
+		{
+			name: "operacion desconocida",
+			ops:  []PatchOp{{Op: "increment", Path: "/phone"}},
+			err:  ErrInvalidPatchOp{"increment", "/phone"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := current
+			firstName, lastName, email, phone, err := applyJSONPatch(&u, tt.ops)
+
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			checkPatched(t, "first_name", firstName, tt.firstName)
+			checkPatched(t, "last_name", lastName, tt.lastName)
+			checkPatched(t, "email", email, tt.email)
+			checkPatched(t, "phone", phone, tt.phone)
+
+			// El usuario original no se toca
+			if u != current {
+				t.Errorf("user was modified: %+v", u)
+			}
+		})
+	}
+}
+
+func checkPatched(t *testing.T, field string, got, want *string) {
+	t.Helper()
+	switch {
+	case got == nil && want == nil:
+	case got == nil || want == nil:
+		t.Errorf("%s = %v, want %v", field, deref(got), deref(want))
+	case *got != *want:
+		t.Errorf("%s = %q, want %q", field, *got, *want)
+	}
+}
+
+func deref(s *string) interface{} {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func raw(s string) json.RawMessage {
+	return json.RawMessage(s)
+}
@@ -0,0 +1,56 @@
+package user
+
+// Normalizacion de telefonos a E.164 (ej: +541144445555). Asi "011 4444-5555", "+54 11 4444 5555" y "1144445555"
+// quedan guardados igual y el filtro por telefono funciona. Lo que escribio el usuario se guarda en phone_display.
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+// Pais que se asume para los numeros que no empiezan con + (codigo ISO 3166-1, ej: AR)
+const DefaultPhoneRegion = "AR"
+
+// NormalizePhone devuelve el telefono en E.164. Falla si no es un numero valido para la region
+func NormalizePhone(phone, region string) (string, error) {
+	if region == "" {
+		region = DefaultPhoneRegion
+	}
+
+	number, err := phonenumbers.Parse(phone, strings.ToUpper(region))
+	if err != nil {
+		return "", err
+	}
+
+	if !phonenumbers.IsValidNumber(number) {
+		return "", ErrInvalidFormat{"phone"}
+	}
+
+	return phonenumbers.Format(number, phonenumbers.E164), nil
+}
+
+// Para guardar: si no se puede normalizar (ej: datos viejos) lo dejamos como vino
+func normalizePhone(phone, region string) string {
+	if phone == "" {
+		return ""
+	}
+	if normalized, err := NormalizePhone(phone, region); err == nil {
+		return normalized
+	}
+	return phone
+}
+
+// Para filtrar: si es un numero completo lo buscamos exacto, si no buscamos los digitos dentro del E.164
+func phoneFilter(phone, region string) (value string, exact bool) {
+	if normalized, err := NormalizePhone(phone, region); err == nil {
+		return normalized, true
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone), false
+}
@@ -0,0 +1,71 @@
+package user
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		name   string
+		phone  string
+		region string
+		want   string // Vacio si es invalido
+	}{
+		{name: "fijo con 0 y guion", phone: "011 4444-5555", region: "AR", want: "+541144445555"},
+		{name: "ya tiene codigo de pais", phone: "+54 11 4444-5555", region: "AR", want: "+541144445555"},
+		{name: "region por defecto", phone: "011 4444-5555", region: "", want: "+541144445555"},
+		{name: "region en minuscula", phone: "1144445555", region: "ar", want: "+541144445555"},
+		{name: "celular con 15", phone: "0351 15-555-1234", region: "AR", want: "+5493515551234"},
+		{name: "celular en E.164", phone: "+54 9 351 555-1234", region: "AR", want: "+5493515551234"},
+		{name: "otra region", phone: "(212) 555-0123", region: "US", want: "+12125550123"},
+		{name: "codigo de pais distinto a la region", phone: "+1 212 555 0123", region: "AR", want: "+12125550123"},
+		{name: "muy corto", phone: "12", region: "AR"},
+		{name: "no es un numero", phone: "abc", region: "AR"},
+		{name: "region desconocida", phone: "011 4444-5555", region: "XX"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizePhone(tt.phone, tt.region)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("NormalizePhone(%q) = %q, want error", tt.phone, got)
+				}
+				// Para guardar, lo que no se puede normalizar queda como vino
+				if stored := normalizePhone(tt.phone, tt.region); stored != tt.phone {
+					t.Errorf("normalizePhone(%q) = %q, want it unchanged", tt.phone, stored)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("NormalizePhone(%q) = %q, %v, want %q", tt.phone, got, err, tt.want)
+			}
+			if stored := normalizePhone(tt.phone, tt.region); stored != tt.want {
+				t.Errorf("normalizePhone(%q) = %q, want %q", tt.phone, stored, tt.want)
+			}
+		})
+	}
+
+	if got := normalizePhone("", "AR"); got != "" {
+		t.Errorf("normalizePhone(\"\") = %q, want empty", got)
+	}
+}
+
+func TestPhoneFilter(t *testing.T) {
+	tests := []struct {
+		phone string
+		value string
+		exact bool
+	}{
+		{"011 4444-5555", "+541144445555", true},
+		{"+54 11 4444 5555", "+541144445555", true},
+		{"4444-5555", "44445555", false},
+		{"(011)", "011", false},
+		{"juan", "", false},
+	}
+
+	for _, tt := range tests {
+		value, exact := phoneFilter(tt.phone, "AR")
+		if value != tt.value || exact != tt.exact {
+			t.Errorf("phoneFilter(%q) = %q, %v, want %q, %v", tt.phone, value, exact, tt.value, tt.exact)
+		}
+	}
+}
@@ -2,35 +2,48 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 
 	"github.com/juanjoaquin/back-g-domain/domain" // Hay que hacer un go get con el link del repo
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository interface {
-	Create(ctx context.Context, user *domain.User) error                                                                 // Le pasamos como puntero al User
-	GetAll(ctx context.Context, filters Filters, offset int, limit int) /* Pasamos el Filtrado */ ([]domain.User, error) // El Get all, nos devuelve un array de usuarios
-	Get(ctx context.Context, id string) (*domain.User, error)                                                            // El Get by ID, nos devuelve un ID, y un puntero de User
-	Delete(ctx context.Context, id string) error
-	Update(ctx context.Context, id string, firstName *string, lastName *string, email *string, phone *string) (*domain.User, error)
-	Count(ctx context.Context, filters Filters) (int, error) // Devuelve la cantidad de registros
+	Create(ctx context.Context, user *domain.User) error                                                                                             // Le pasamos como puntero al User
+	CreateBatch(ctx context.Context, users []*domain.User) error                                                                                     // Inserta todos los usuarios en un solo INSERT (todos o ninguno)
+	GetAll(ctx context.Context, filters Filters, sort []SortField, fields []string, offset int, limit int) /* Pasamos el Filtrado */ ([]User, error) // El Get all, nos devuelve un array de usuarios
+	GetAllAfter(ctx context.Context, filters Filters, cursor *Cursor, fields []string, limit int) ([]User, error)                                    // Get All por keyset (created_at + id)
+	Get(ctx context.Context, id string, fields []string) (*User, error)                                                                              // El Get by ID, nos devuelve un ID, y un puntero de User
+	Delete(ctx context.Context, id string, pre *Precondition) error                                                                                  // Con precondicion solo borra si coincide la version (If-Match)
+	Purge(ctx context.Context, id string, pre *Precondition) error                                                                                   // Borrado fisico (DELETE real), incluso si ya estaba borrado
+	Restore(ctx context.Context, id string) (*User, error)                                                                                           // Deshace el soft delete
+	Update(ctx context.Context, id string, firstName *string, lastName *string, email *string, phone *string, pre *Precondition) (*User, error)
+	Replace(ctx context.Context, user *domain.User, upsert bool, pre *Precondition) (*User, bool, error)                                     // Reemplaza todas las columnas, con upsert crea si no existe
+	UpdateMany(ctx context.Context, filters Filters, firstName *string, lastName *string, email *string, phone *string) (*BulkResult, error) // Modifica en una transaccion a los que coinciden con los filtros
+	DeleteMany(ctx context.Context, filters Filters) (*BulkResult, error)                                                                    // Borra en una transaccion a los que coinciden con los filtros
+	Stream(ctx context.Context, filters Filters, batchSize int, fn func(users []User) error) error                                           // Recorre por lotes los que coinciden con los filtros
+	Count(ctx context.Context, filters Filters) (int, error)                                                                                 // Devuelve la cantidad de registros
+	EmailsInUse(ctx context.Context, emails []string) (map[string]bool, error)                                                               // De los emails (normalizados) devuelve los que ya tienen usuario
 }
 
 // Esta struct va hacer referencia a la DB de GORM
 type repo struct {
-	log *log.Logger
-	db  *gorm.DB
+	log         *log.Logger
+	db          *gorm.DB
+	phoneRegion string // Pais por defecto para normalizar los telefonos (ver NormalizePhone)
 }
 
 // Creamos una funcion que va a instanciar este repo.
 
-func NewRepo(log *log.Logger, db *gorm.DB) Repository {
+func NewRepo(log *log.Logger, db *gorm.DB, phoneRegion string) Repository {
 	return &repo{
-		log: log,
-		db:  db,
+		log:         log,
+		db:          db,
+		phoneRegion: phoneRegion,
 	}
 }
 
@@ -44,13 +57,15 @@ func (repo *repo) Create(ctx context.Context, user *domain.User) error {
 	// user.ID = uuid.New().String()
 
 	/* Tenemos que hacer del objeto  de "db" el metodo "Create", llamando a nuestra Struct (repo) que le debemos pasar la entidad del User */
-	result := repo.db.WithContext(ctx).Create(user) // Aca le pasamos el Context
+	// Guardamos el userRow para que tambien se graben los nombres normalizados
+	row := newUserRow(*user, repo.phoneRegion)
+	result := repo.db.WithContext(ctx).Create(&row) // Aca le pasamos el Context
 
 	// Tenemos 2 tipos de manejos de error. Este en el que le decimos, que si el resultado da error, y es distinto a null que lo tire:
 
 	if result.Error != nil {
 		repo.log.Println("[ERROR]-[REPOSITORY]-[CREATE]", result.Error)
-		return result.Error
+		return duplicateEmailError(result.Error, user.Email)
 	}
 
 	// O este donde seteamos con la funcion propia en la creacion del User, y no una vez previamente declara como en la primera opcion
@@ -59,34 +74,64 @@ func (repo *repo) Create(ctx context.Context, user *domain.User) error {
 		return err
 	} */
 
+	// Devolvemos el User con el ID y las fechas que genero GORM
+	*user = row.User
+
 	repo.log.Println("User creado exitosamente", user.ID)
 
 	return nil
 }
 
+// Metodo para el alta masiva. Es un solo INSERT, si falla no se crea ninguno
+func (repo *repo) CreateBatch(ctx context.Context, users []*domain.User) error {
+	rows := make([]userRow, 0, len(users))
+	for _, u := range users {
+		rows = append(rows, newUserRow(*u, repo.phoneRegion))
+	}
+
+	if err := repo.db.WithContext(ctx).Create(&rows).Error; err != nil {
+		repo.log.Println("[ERROR]-[REPOSITORY]-[CREATE-BATCH]", err)
+		return translateError(err)
+	}
+
+	// Devolvemos los IDs y fechas generados a cada User
+	for i := range rows {
+		*users[i] = rows[i].User
+	}
+
+	repo.log.Println("Users creados exitosamente", len(rows))
+
+	return nil
+}
+
 // Creamo el Metodo Get All
-func (repo *repo) GetAll(ctx context.Context, filters Filters, offset, limit int) ([]domain.User, error) {
-	var u []domain.User // Declaramos la variable user. Que sera un vector de usuarios
+func (repo *repo) GetAll(ctx context.Context, filters Filters, sort []SortField, fields []string, offset, limit int) ([]User, error) {
+	var u []User // Declaramos la variable user. Que sera un vector de usuarios
 
 	// Debemos traernos el Model del User
 	tx := repo.db.WithContext(ctx).Model(u)
 	// Nos traemos el filtrado, y se lo pasamos
-	tx = applyFilters(tx, filters)
+	tx = applyFilters(tx, filters, repo.phoneRegion)
 	// Con GORM especificamos tanto el limit & el offset
 	tx = tx.Limit(limit).Offset(offset)
+	// Si pidieron solo algunos campos, seleccionamos solo esas columnas
+	if len(fields) > 0 {
+		tx = tx.Select(selectColumns(fields))
+	}
 
 	/* Utilizamos la funcion de nuestro repo, para tener la DB, y ejecutar el metodo "Model"
 	Con esto especificamos el Modelo que vamos a utilizar. En este caso el User, con su puntero */
 	/* result := repo.db.Model(&u).Order("created_at desc").Find(&u) */ // Le aplicamos un orderBy, y un Find para encontrar el user
 
 	//Ahora con el filtrado, le pasamos directamente el tx.Order, y no como esta arriba, es lo mismo, pero le aplicamos el filtrado
-	result := tx.Order("created_at desc").Find(&u)
+	// El orden lo arma applySort con lo que pidio el cliente (por defecto created_at desc)
+	result := applySort(tx, sort, filters.Search).Find(&u)
 
 	// Hanldeamos el error
 	if result.Error != nil {
 		repo.log.Println("[ERROR]-[REPOSITORY]-[GET-ALL]", result.Error)
 
-		return nil, result.Error
+		return nil, translateError(result.Error)
 	}
 
 	// Returnamos el user y el nil
@@ -96,18 +141,51 @@ func (repo *repo) GetAll(ctx context.Context, filters Filters, offset, limit int
 	/////////////////////////////////////
 }
 
+// Metodo Get All por cursor. Ordenamos por created_at + id para que el orden sea estable
+// aunque se creen usuarios mientras el cliente recorre las paginas
+func (repo *repo) GetAllAfter(ctx context.Context, filters Filters, cursor *Cursor, fields []string, limit int) ([]User, error) {
+	var u []User
+
+	tx := repo.db.WithContext(ctx).Model(u)
+	tx = applyFilters(tx, filters, repo.phoneRegion)
+
+	// Para armar el siguiente cursor siempre necesitamos el id y el created_at
+	if len(fields) > 0 {
+		tx = tx.Select(selectColumns(fields, "id", "created_at"))
+	}
+
+	// Traemos solo los registros que estan despues del cursor
+	if cursor != nil {
+		tx = tx.Where("(created_at < ? OR (created_at = ? AND id < ?))", cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+
+	result := tx.Order("created_at desc").Order("id desc").Limit(limit).Find(&u)
+	if result.Error != nil {
+		repo.log.Println("[ERROR]-[REPOSITORY]-[GET-ALL-AFTER]", result.Error)
+		return nil, translateError(result.Error)
+	}
+
+	return u, nil
+}
+
 // Creamo el Metodo Get By ID
-func (repo *repo) Get(ctx context.Context, id string) (*domain.User, error) {
+func (repo *repo) Get(ctx context.Context, id string, fields []string) (*User, error) {
 	/* Primero debemos generar una estructura User para poder pasarle el ID a GORM */
-	user := domain.User{ID: id}
+	user := User{User: domain.User{ID: id}}
+
+	tx := repo.db.WithContext(ctx)
+	if len(fields) > 0 {
+		tx = tx.Select(selectColumns(fields))
+	}
 
 	/* Para buscar la informacion, utilizamos el .First() con el puntero en el User.  */
-	if err := repo.db.WithContext(ctx).First(&user).Error; err != nil {
+	// Solo el "record not found" es un 404. Una caida de la DB o un timeout no significan que el usuario no exista
+	if err := tx.First(&user).Error; err != nil {
 		repo.log.Println(err)
-		if err == gorm.ErrRecordNotFound {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrUserNotFound{id}
 		}
-		return nil, ErrUserNotFound{id}
+		return nil, translateError(err)
 	} // First es el primer elemento que encuentra
 
 	// Devolvemos al puntero del User, tanto como el nil. No se devuelve el result
@@ -116,23 +194,23 @@ func (repo *repo) Get(ctx context.Context, id string) (*domain.User, error) {
 }
 
 // Creamos el Metodo DELETE
-func (repo *repo) Delete(ctx context.Context, id string) error {
+func (repo *repo) Delete(ctx context.Context, id string, pre *Precondition) error {
 	/* Primero debemos generar una estructura User para poder pasarle el ID a GORM */
 	user := domain.User{ID: id}
 
-	result := repo.db.WithContext(ctx).Delete(&user)
+	// La version (If-Match) se valida en el mismo WHERE, asi es atomico
+	result := applyPrecondition(repo.db.WithContext(ctx), pre).Delete(&user)
 
 	// El metodo que se usa es el .DELETE
 
 	if result.Error != nil {
 		repo.log.Println(result.Error)
-		return result.Error
+		return translateError(result.Error)
 	}
 
 	// Esto se usa solo con RESULT. En caso de que venga con Rows = 0. Lanzamos el mensaje del error.
 	if result.RowsAffected == 0 {
-		repo.log.Printf("user %s doesnt exists", id)
-		return ErrUserNotFound{id}
+		return repo.notAffectedError(repo.db.WithContext(ctx), id, pre)
 	}
 
 	// Devolvemos nil. No se devuelve el result
@@ -140,72 +218,500 @@ func (repo *repo) Delete(ctx context.Context, id string) error {
 
 }
 
+// Metodo PURGE. Con Unscoped GORM hace el DELETE de verdad, sin pasar por la columna deleted
+func (repo *repo) Purge(ctx context.Context, id string, pre *Precondition) error {
+	result := applyPrecondition(repo.db.WithContext(ctx).Unscoped(), pre).Where("id = ?", id).Delete(&userRow{})
+
+	if result.Error != nil {
+		repo.log.Println("[ERROR]-[REPOSITORY]-[PURGE]", result.Error)
+		return translateError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return repo.notAffectedError(repo.db.WithContext(ctx).Unscoped(), id, pre)
+	}
+
+	repo.log.Println("User eliminado definitivamente", id)
+
+	return nil
+}
+
+// Metodo RESTORE. Solo se puede restaurar un usuario que este borrado
+func (repo *repo) Restore(ctx context.Context, id string) (*User, error) {
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current userRow
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).Take(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound{id}
+		}
+		if err != nil {
+			return err
+		}
+
+		if !current.Deleted.Valid {
+			return ErrUserNotDeleted{id}
+		}
+
+		values := map[string]interface{}{"deleted": nil, "updated_at": now()}
+		return tx.Unscoped().Model(&userRow{}).Where("id = ?", id).Updates(values).Error
+	})
+
+	if err != nil {
+		repo.log.Println("[ERROR]-[REPOSITORY]-[RESTORE]", err)
+		return nil, translateError(err)
+	}
+
+	var user User
+	if err := repo.db.WithContext(ctx).Where("id = ?", id).First(&user).Error; err != nil {
+		repo.log.Println(err)
+		return nil, translateError(err)
+	}
+
+	repo.log.Println("User restaurado", id)
+
+	return &user, nil
+}
+
 // Creamos el Metodo UPDATE
 
-func (repo *repo) Update(ctx context.Context, id string, firstName *string, lastName *string, email *string, phone *string) (*domain.User, error) {
+func (repo *repo) Update(ctx context.Context, id string, firstName *string, lastName *string, email *string, phone *string, pre *Precondition) (*User, error) {
+	values := updateValues(firstName, lastName, email, phone, repo.phoneRegion)
+
+	tx := repo.db.WithContext(ctx).Model(&userRow{}).Where("id = ?", id)
+	result := applyPrecondition(tx, pre).Updates(values)
+
+	if result.Error != nil {
+		repo.log.Println(result.Error)
+		if email != nil {
+			return nil, duplicateEmailError(result.Error, *email)
+		}
+		return nil, translateError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, repo.notAffectedError(repo.db.WithContext(ctx), id, pre)
+	}
+
+	// 👇 NUEVO: Obtén el usuario actualizado
+	var user User
+	if err := repo.db.WithContext(ctx).Where("id = ?", id).First(&user).Error; err != nil {
+		repo.log.Println(err)
+		return nil, translateError(err)
+	}
+
+	return &user, nil
+}
+
+// Metodo REPLACE (PUT). Pisamos todas las columnas editables, incluso con valores vacios.
+// Si no existe y esta habilitado el upsert lo creamos con el mismo id. Si estaba borrado (soft delete) lo restauramos
+func (repo *repo) Replace(ctx context.Context, user *domain.User, upsert bool, pre *Precondition) (*User, bool, error) {
+	created := false
+
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current userRow
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", user.ID).Take(&current).Error
+
+		exists := err == nil && !current.Deleted.Valid
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if !exists && !upsert {
+			return ErrUserNotFound{user.ID}
+		}
+
+		// El registro esta bloqueado (FOR UPDATE), asi que comparar la version aca tambien es atomico
+		if exists && !pre.matches(&current.User) {
+			return ErrPreconditionFailed
+		}
+
+		// No existe ni borrado: lo creamos con el id que nos mandaron
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			row := newUserRow(*user, repo.phoneRegion)
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+			created = true
+			return nil
+		}
+
+		// Si estaba borrado, para el cliente es un alta
+		values := updateValues(&user.FirstName, &user.LastName, &user.Email, &user.Phone, repo.phoneRegion)
+		values["deleted"] = nil
+		created = !exists
+		return tx.Unscoped().Model(&userRow{}).Where("id = ?", user.ID).Updates(values).Error
+	})
+
+	if err != nil {
+		repo.log.Println("[ERROR]-[REPOSITORY]-[REPLACE]", err)
+		return nil, false, duplicateEmailError(err, user.Email)
+	}
+
+	// Devolvemos el usuario como quedo en la DB (con las fechas)
+	var replaced User
+	if err := repo.db.WithContext(ctx).Where("id = ?", user.ID).First(&replaced).Error; err != nil {
+		repo.log.Println(err)
+		return nil, false, translateError(err)
+	}
+
+	return &replaced, created, nil
+}
+
+// Armamos el map de columnas a modificar, solo con los campos que vinieron
+func updateValues(firstName *string, lastName *string, email *string, phone *string, phoneRegion string) map[string]interface{} {
 	values := make(map[string]interface{})
 
+	// Si cambia el nombre, tambien actualizamos la columna normalizada
 	if firstName != nil {
 		values["first_name"] = *firstName
+		values["first_name_search"] = Fold(*firstName)
 	}
 
 	if lastName != nil {
 		values["last_name"] = *lastName
+		values["last_name_search"] = Fold(*lastName)
 	}
 
 	if email != nil {
 		values["email"] = *email
+		values["email_key"] = emailKey(*email)
 	}
 
+	// El telefono se guarda en E.164 y tal cual lo escribieron en phone_display
 	if phone != nil {
-		values["phone"] = *phone
+		values["phone"] = normalizePhone(*phone, phoneRegion)
+		values["phone_display"] = *phone
 	}
 
-	result := repo.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", id).Updates(values)
+	// Lo seteamos nosotros para guardarlo con la misma precision que el ETag
+	values["updated_at"] = now()
 
-	if result.Error != nil {
-		repo.log.Println(result.Error)
-		return nil, result.Error
+	return values
+}
+
+// Si viene el If-Match, solo tocamos el registro si su updated_at coincide con alguna de las versiones
+func applyPrecondition(tx *gorm.DB, pre *Precondition) *gorm.DB {
+	if pre == nil {
+		return tx
 	}
+	if len(pre.Versions) == 0 {
+		return tx.Where("1 = 0")
+	}
+	return tx.Where("updated_at IN ?", pre.Versions)
+}
 
-	if result.RowsAffected == 0 {
-		repo.log.Printf("user %s doesnt exists", id)
-		return nil, ErrUserNotFound{id}
+// Cuando no se afecto ninguna fila puede ser porque no existe o porque la version no coincide.
+// El tx define si se tienen en cuenta los borrados (Unscoped) o no
+func (repo *repo) notAffectedError(tx *gorm.DB, id string, pre *Precondition) error {
+	if pre != nil {
+		var count int64
+		if err := tx.Model(&domain.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			repo.log.Println(err)
+			return translateError(err)
+		}
+		if count > 0 {
+			repo.log.Printf("user %s was modified", id)
+			return ErrPreconditionFailed
+		}
 	}
 
-	// 👇 NUEVO: Obtén el usuario actualizado
-	var user domain.User
-	if err := repo.db.WithContext(ctx).Where("id = ?", id).First(&user).Error; err != nil {
-		repo.log.Println(err)
+	repo.log.Printf("user %s doesnt exists", id)
+	return ErrUserNotFound{id}
+}
+
+// Ademas de la PK, el unico indice unico es el del email
+func duplicateEmailError(err error, email string) error {
+	if isDuplicateKey(err) {
+		return ErrEmailAlreadyExists{NormalizeEmail(email)}
+	}
+	return translateError(err)
+}
+
+// Metodo de modificacion masiva. Bloqueamos los registros que coinciden y los modificamos en la misma transaccion
+func (repo *repo) UpdateMany(ctx context.Context, filters Filters, firstName *string, lastName *string, email *string, phone *string) (*BulkResult, error) {
+	var result *BulkResult
+
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ids, err := lockIDs(tx, filters, repo.phoneRegion)
+		if err != nil {
+			return err
+		}
+
+		if len(ids) > 0 {
+			values := updateValues(firstName, lastName, email, phone, repo.phoneRegion)
+			if err := tx.Model(&userRow{}).Where("id IN ?", ids).Updates(values).Error; err != nil {
+				return err
+			}
+		}
+
+		result = newBulkResult(ids, filters.IDs)
+		return nil
+	})
+
+	if err != nil {
+		repo.log.Println("[ERROR]-[REPOSITORY]-[UPDATE-MANY]", err)
+		if email != nil {
+			return nil, duplicateEmailError(err, *email)
+		}
+		return nil, translateError(err)
+	}
+
+	return result, nil
+}
+
+// Metodo de baja masiva (soft delete, igual que el Delete)
+func (repo *repo) DeleteMany(ctx context.Context, filters Filters) (*BulkResult, error) {
+	var result *BulkResult
+
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ids, err := lockIDs(tx, filters, repo.phoneRegion)
+		if err != nil {
+			return err
+		}
+
+		if len(ids) > 0 {
+			if err := tx.Where("id IN ?", ids).Delete(&domain.User{}).Error; err != nil {
+				return err
+			}
+		}
+
+		result = newBulkResult(ids, filters.IDs)
+		return nil
+	})
+
+	if err != nil {
+		repo.log.Println("[ERROR]-[REPOSITORY]-[DELETE-MANY]", err)
+		return nil, translateError(err)
+	}
+
+	return result, nil
+}
+
+// Traemos los ids que coinciden con los filtros con un SELECT ... FOR UPDATE.
+// Como maximo bloqueamos maxBulkItems, si el filtro trae mas no modificamos nada
+func lockIDs(tx *gorm.DB, filters Filters, phoneRegion string) ([]string, error) {
+	var ids []string
+	q := applyFilters(tx.Model(&domain.User{}), filters, phoneRegion).Clauses(clause.Locking{Strength: "UPDATE"})
+	if err := q.Limit(maxBulkItems+1).Pluck("id", &ids).Error; err != nil {
 		return nil, err
 	}
+	if len(ids) > maxBulkItems {
+		return nil, ErrBulkTooLarge
+	}
+	return ids, nil
+}
 
-	return &user, nil
+// Los ids pedidos que no aparecieron entre los afectados son los no encontrados
+func newBulkResult(affected []string, requested []string) *BulkResult {
+	found := make(map[string]bool, len(affected))
+	for _, id := range affected {
+		found[id] = true
+	}
+
+	result := &BulkResult{Affected: affected, NotFound: []string{}}
+	if result.Affected == nil {
+		result.Affected = []string{}
+	}
+
+	for _, id := range requested {
+		if !found[id] {
+			result.NotFound = append(result.NotFound, id)
+		}
+	}
+
+	return result
 }
+
 // FUNCION PARA EL APLICADO DE FILTROS
-func applyFilters(tx *gorm.DB, filters Filters) *gorm.DB {
+func applyFilters(tx *gorm.DB, filters Filters, phoneRegion string) *gorm.DB {
+
+	// Los nombres ya vienen normalizados desde el service (ver Fold), los comparamos contra las columnas normalizadas
+	if filters.FirstName != "" { // Basicamente que si viene vacio, no pasa nada
+		filters.FirstName = fmt.Sprintf("%%%s%%", filters.FirstName)
+		tx = tx.Where("first_name_search like ?", filters.FirstName) // Query de GORM para la consulta
+	}
+
+	if filters.LastName != "" { // Basicamente que si viene vacio, no pasa nada
+		filters.LastName = fmt.Sprintf("%%%s%%", filters.LastName)
+		tx = tx.Where("last_name_search like ?", filters.LastName) // Query de GORM para la consulta
+	}
+
+	if filters.Email != "" {
+		tx = tx.Where("lower(email) = ?", strings.ToLower(filters.Email))
+	}
+
+	if filters.EmailLike != "" {
+		tx = tx.Where("lower(email) like ?", fmt.Sprintf("%%%s%%", strings.ToLower(filters.EmailLike)))
+	}
+
+	// Los telefonos estan en E.164: un numero completo se busca exacto y uno parcial por sus digitos
+	if filters.Phone != "" {
+		value, exact := phoneFilter(filters.Phone, phoneRegion)
+		switch {
+		case exact:
+			tx = tx.Where("phone = ?", value)
+		case value != "":
+			tx = tx.Where("phone like ?", fmt.Sprintf("%%%s%%", value))
+		default:
+			tx = tx.Where("phone like ?", fmt.Sprintf("%%%s%%", filters.Phone))
+		}
+	}
 
-	if filters.FirstName != "" { // Basicamente que si viene vacio, no pasa nada, y que lo devuelva en lower o uppercase
-		filters.FirstName = fmt.Sprintf("%%%s%%", strings.ToLower(filters.FirstName))
-		tx = tx.Where("lower(first_name) like ?", filters.FirstName) // Query de GORM para la consulta
+	if len(filters.IDs) > 0 {
+		tx = tx.Where("id IN ?", filters.IDs)
 	}
 
-	if filters.LastName != "" { // Basicamente que si viene vacio, no pasa nada, y que lo devuelva en lower o uppercase
-		filters.LastName = fmt.Sprintf("%%%s%%", strings.ToLower(filters.LastName))
-		tx = tx.Where("lower(last_name) like ?", filters.LastName) // Query de GORM para la consulta
+	// Rangos de fechas. Los dos extremos son inclusivos
+	if filters.CreatedFrom != nil {
+		tx = tx.Where("created_at >= ?", *filters.CreatedFrom)
+	}
+
+	if filters.CreatedTo != nil {
+		tx = tx.Where("created_at <= ?", *filters.CreatedTo)
+	}
+
+	if filters.UpdatedFrom != nil {
+		tx = tx.Where("updated_at >= ?", *filters.UpdatedFrom)
+	}
+
+	if filters.UpdatedTo != nil {
+		tx = tx.Where("updated_at <= ?", *filters.UpdatedTo)
+	}
+
+	if filters.Search != "" {
+		tx = applySearch(tx, filters.Search, phoneRegion)
+	}
+
+	// Por defecto GORM excluye los borrados. Con Unscoped los incluimos
+	switch filters.Deleted {
+	case DeletedInclude:
+		tx = tx.Unscoped()
+	case DeletedOnly:
+		tx = tx.Unscoped().Where("deleted IS NOT NULL")
 	}
 
 	return tx
 }
 
+// FUNCION PARA LA BUSQUEDA LIBRE (param q)
+// Separamos el texto en palabras. Cada palabra tiene que aparecer en alguno de los campos (nombre, apellido, email o telefono).
+// Si todo el texto es un telefono completo (ej: "011 4444-5555") lo buscamos exacto, igual que el filtro phone
+func applySearch(tx *gorm.DB, search string, phoneRegion string) *gorm.DB {
+	if phone, exact := phoneFilter(search, phoneRegion); exact {
+		return tx.Where("phone = ?", phone)
+	}
+
+	for _, token := range searchTokens(search) {
+		like := fmt.Sprintf("%%%s%%", token)
+
+		// El telefono esta en E.164, asi que lo comparamos con los digitos de la palabra. Si no tiene digitos no puede ser el telefono
+		phone, _ := phoneFilter(token, phoneRegion)
+		if phone == "" {
+			tx = tx.Where("(first_name_search like ? OR last_name_search like ? OR lower(email) like ?)", like, like, like)
+			continue
+		}
+
+		tx = tx.Where("(first_name_search like ? OR last_name_search like ? OR lower(email) like ? OR phone like ?)", like, like, like, fmt.Sprintf("%%%s%%", phone))
+	}
+	return tx
+}
+
+func searchTokens(search string) []string {
+	return strings.Fields(strings.ToLower(search))
+}
+
+// Puntaje de relevancia: match exacto del nombre/apellido vale 3, si empieza con la palabra vale 2 y si es el email vale 1.
+// Se suma por cada palabra de la busqueda
+func relevanceOrder(search string) clause.OrderBy {
+	var parts []string
+	var vars []interface{}
+
+	for _, token := range searchTokens(search) {
+		prefix := token + "%"
+		parts = append(parts, "CASE WHEN first_name_search = ? OR last_name_search = ? THEN 3 "+
+			"WHEN first_name_search like ? OR last_name_search like ? THEN 2 "+
+			"WHEN lower(email) like ? THEN 1 ELSE 0 END")
+		vars = append(vars, token, token, prefix, prefix, prefix)
+	}
+
+	return clause.OrderBy{Expression: clause.Expr{
+		SQL:                "(" + strings.Join(parts, " + ") + ") DESC",
+		Vars:               vars,
+		WithoutParentheses: true,
+	}}
+}
+
+// FUNCION PARA EL ORDENAMIENTO
+// Las columnas ya vienen validadas contra la whitelist de ParseSort. Siempre desempatamos por id para que las paginas sean estables
+func applySort(tx *gorm.DB, sort []SortField, search string) *gorm.DB {
+	if len(sort) == 0 {
+		return tx.Order("created_at desc").Order("id desc")
+	}
+
+	for _, s := range sort {
+		// La relevancia siempre ordena de mas relevante a menos, sin importar el "-"
+		if s.Column == relevanceSort {
+			if search != "" {
+				tx = tx.Order(relevanceOrder(search))
+			}
+			continue
+		}
+		tx = tx.Order(clause.OrderByColumn{Column: clause.Column{Name: s.Column}, Desc: s.Desc})
+	}
+
+	return tx.Order("id")
+}
+
+// Metodo para recorrer la tabla por lotes. FindInBatches pagina por id (keyset), asi no se degrada con tablas grandes
+func (repo *repo) Stream(ctx context.Context, filters Filters, batchSize int, fn func(users []User) error) error {
+	var users []User
+
+	tx := applyFilters(repo.db.WithContext(ctx).Model(&User{}), filters, repo.phoneRegion)
+	result := tx.FindInBatches(&users, batchSize, func(_ *gorm.DB, _ int) error {
+		return fn(users)
+	})
+
+	if result.Error != nil {
+		repo.log.Println("[ERROR]-[REPOSITORY]-[STREAM]", result.Error)
+		return translateError(result.Error)
+	}
+
+	return nil
+}
+
 // FUNCION PARA EL CONTADOR DEL REGISTRO
 func (repo *repo) Count(ctx context.Context, filters Filters) (int, error) {
 	var count int64
 	tx := repo.db.WithContext(ctx).Model(domain.User{})
-	tx = applyFilters(tx, filters)
+	tx = applyFilters(tx, filters, repo.phoneRegion)
 	if err := tx.Count(&count).Error; err != nil {
 		repo.log.Println(err) // Imprimimos posiblemente los errores
-		return 0, err
+		return 0, translateError(err)
 	}
 	return int(count), nil
 }
+
+// Buscamos por email_key igual que el indice unico, incluidos los borrados (el soft delete no libera el email)
+func (repo *repo) EmailsInUse(ctx context.Context, emails []string) (map[string]bool, error) {
+	inUse := make(map[string]bool)
+
+	for start := 0; start < len(emails); start += maxBulkItems {
+		end := start + maxBulkItems
+		if end > len(emails) {
+			end = len(emails)
+		}
+
+		var found []string
+		err := repo.db.WithContext(ctx).Unscoped().Model(&userRow{}).Where("email_key IN ?", emails[start:end]).Pluck("email_key", &found).Error
+		if err != nil {
+			repo.log.Println("[ERROR]-[REPOSITORY]-[EMAILS-IN-USE]", err)
+			return nil, translateError(err)
+		}
+
+		for _, email := range found {
+			inUse[email] = true
+		}
+	}
+
+	return inUse, nil
+}
@@ -0,0 +1,74 @@
+package user
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// DryRun: GORM arma el SQL sin conectarse a la DB
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:pass@tcp(localhost:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestApplySearch(t *testing.T) {
+	tests := []struct {
+		name   string
+		search string
+		where  []string // Partes del WHERE, en orden
+		vars   []interface{}
+	}{
+		{
+			name:   "telefono completo se busca exacto en E.164",
+			search: "011 4444-5555",
+			where:  []string{"phone = ?"},
+			vars:   []interface{}{"+541144445555"},
+		},
+		{
+			name:   "palabra sin digitos no compara el telefono",
+			search: "juan",
+			where:  []string{"first_name_search like ? OR last_name_search like ? OR lower(email) like ?)"},
+			vars:   []interface{}{"%juan%", "%juan%", "%juan%"},
+		},
+		{
+			name:   "numero parcial compara sus digitos",
+			search: "juan 4444-5555",
+			where: []string{
+				"first_name_search like ? OR last_name_search like ? OR lower(email) like ?)",
+				"first_name_search like ? OR last_name_search like ? OR lower(email) like ? OR phone like ?)",
+			},
+			vars: []interface{}{"%juan%", "%juan%", "%juan%", "%4444-5555%", "%4444-5555%", "%4444-5555%", "%44445555%"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt := applySearch(dryRunDB(t).Model(&User{}), tt.search, "AR").Find(&[]User{}).Statement
+
+			sql := stmt.SQL.String()
+			rest := sql
+			for _, part := range tt.where {
+				i := strings.Index(rest, part)
+				if i < 0 {
+					t.Fatalf("SQL %q does not contain %q", sql, part)
+				}
+				rest = rest[i+len(part):]
+			}
+			if got, want := strings.Count(sql, "phone like"), strings.Count(strings.Join(tt.where, " "), "phone like"); got != want {
+				t.Errorf("SQL %q compares the phone %d times, want %d", sql, got, want)
+			}
+
+			if !reflect.DeepEqual(stmt.Vars, tt.vars) {
+				t.Errorf("vars = %v, want %v", stmt.Vars, tt.vars)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package user
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/juanjoaquin/back-g-domain/domain"
 )
@@ -11,18 +12,55 @@ import (
 type Service interface {
 	/* 	1. Vamos a definirle los metodos de los Endpoints que fuimos utilizando.
 	   	Le pasaremos tambien los elementos del body del Create por ejemplo */
-	Create(ctx context.Context, firstName, lastName, email, phone string) (*domain.User, error)
-	GetAll(ctx context.Context, filters Filters, offset, limit int) /* Pasamos el Filtrado de params */ ([]domain.User, error) // Get All
-	Get(ctx context.Context, id string) (*domain.User, error)                                                                  // Get by User ID
-	Delete(ctx context.Context, id string) error
-    Update(ctx context.Context, id string, firstName *string, lastName *string, email *string, phone *string) (*domain.User, error) // 👈 Cambia esto
+	Create(ctx context.Context, firstName, lastName, email, phone string) (*User, error)
+	CreateMany(ctx context.Context, users []*domain.User) []error                                                                                          // Devuelve un error por cada usuario (nil si se creo)
+	GetAll(ctx context.Context, filters Filters, sort []SortField, fields []string, offset, limit int) /* Pasamos el Filtrado de params */ ([]User, error) // Get All
+	GetAllAfter(ctx context.Context, filters Filters, cursor *Cursor, fields []string, limit int) ([]User, error)                                          // Get All por cursor
+	Get(ctx context.Context, id string, fields []string) (*User, error)                                                                                    // Get by User ID
+	Delete(ctx context.Context, id string, pre *Precondition) error
+	Purge(ctx context.Context, id string, pre *Precondition) error                                                                              // Borrado definitivo
+	Restore(ctx context.Context, id string) (*User, error)                                                                                      // Deshace el soft delete
+	Update(ctx context.Context, id string, firstName *string, lastName *string, email *string, phone *string, pre *Precondition) (*User, error) // 👈 Cambia esto
+	Replace(ctx context.Context, user *domain.User, upsert bool, pre *Precondition) (*User, bool, error)                                        // Devuelve true si el usuario se creo
+	UpdateMany(ctx context.Context, filters Filters, firstName *string, lastName *string, email *string, phone *string) (*BulkResult, error)
+	DeleteMany(ctx context.Context, filters Filters) (*BulkResult, error)
+	Export(ctx context.Context, filters Filters, fn func(users []User) error) error // Recorre todos los usuarios por lotes
 	Count(ctx context.Context, filters Filters) (int, error)
+	EmailsInUse(ctx context.Context, emails []string) (map[string]bool, error) // De los emails devuelve los que ya tienen usuario
 }
 
+const (
+	createBatchSize = 100 // Cantidad de usuarios por INSERT en el alta masiva
+	exportBatchSize = 500 // Cantidad de usuarios por lote en el export
+)
+
 // Struct de Filter params:
 type Filters struct {
-	FirstName string
-	LastName  string
+	FirstName   string
+	LastName    string
+	Email       string   // Match exacto (sin importar mayusculas)
+	EmailLike   string   // Match parcial
+	Phone       string   // Match parcial
+	IDs         []string // Lista de IDs
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	UpdatedFrom *time.Time
+	UpdatedTo   *time.Time
+	Search      string // Busqueda libre en nombre, apellido, email y telefono
+	Deleted     string // Visibilidad de los borrados (ver ParseDeleted)
+}
+
+// Resultado de las operaciones masivas. NotFound son los ids pedidos que no existen
+type BulkResult struct {
+	Affected []string `json:"affected"`
+	NotFound []string `json:"not_found"`
+}
+
+// Sin ningun filtro una operacion masiva afectaria a toda la tabla
+func (f Filters) isEmpty() bool {
+	return f.FirstName == "" && f.LastName == "" && f.Email == "" && f.EmailLike == "" && f.Phone == "" &&
+		len(f.IDs) == 0 && f.CreatedFrom == nil && f.CreatedTo == nil && f.UpdatedFrom == nil && f.UpdatedTo == nil &&
+		f.Search == ""
 }
 
 /* 2. Vamos a definir una struct, está sera en privado */
@@ -44,7 +82,7 @@ func NewService(log *log.Logger, repo Repository) Service {
 }
 
 /* 4. Vamos a generar un metodo, que esto se lo deberemos pasar a la funcion de NewService. */
-func (s service) Create(ctx context.Context, firstName, lastName, email, phone string) (*domain.User, error) {
+func (s service) Create(ctx context.Context, firstName, lastName, email, phone string) (*User, error) {
 
 	s.log.Println("Create user service")
 
@@ -53,7 +91,7 @@ func (s service) Create(ctx context.Context, firstName, lastName, email, phone s
 		// Una vez terminado esto, se lo debemos pasar al Repositorio
 		FirstName: firstName,
 		LastName:  lastName,
-		Email:     email,
+		Email:     NormalizeEmail(email),
 		Phone:     phone,
 	}
 
@@ -63,14 +101,53 @@ func (s service) Create(ctx context.Context, firstName, lastName, email, phone s
 		return nil, err
 	}
 
-	return &user, nil
+	// El phone queda normalizado, en phone_display devolvemos el que mando el cliente (ver newUserRow)
+	return &User{User: user, PhoneDisplay: phone}, nil
+}
+
+/* Alta masiva. Insertamos en lotes, y si un lote falla por un duplicado lo reintentamos de a uno para saber que usuario fallo */
+func (s service) CreateMany(ctx context.Context, users []*domain.User) []error {
+	s.log.Println("Create many users service")
+
+	errs := make([]error, len(users))
+	for _, u := range users {
+		u.Email = NormalizeEmail(u.Email)
+	}
+
+	for start := 0; start < len(users); start += createBatchSize {
+		end := start + createBatchSize
+		if end > len(users) {
+			end = len(users)
+		}
+
+		err := s.repo.CreateBatch(ctx, users[start:end])
+		if err == nil {
+			continue
+		}
+
+		// Solo un duplicado o un dato que la DB no acepta puede ser culpa de un usuario en particular.
+		// Si la DB esta caida o no responde, reintentar de a uno son cientos de INSERT que fallan igual,
+		// asi que todos los que faltan se quedan con ese error
+		if kind := KindOf(err); kind != KindConflict && kind != KindConstraint {
+			for i := start; i < len(users); i++ {
+				errs[i] = err
+			}
+			break
+		}
+
+		for i := start; i < end; i++ {
+			errs[i] = s.repo.Create(ctx, users[i])
+		}
+	}
+
+	return errs
 }
 
 /* Get All de los Users */
-func (s service) GetAll(ctx context.Context, filters Filters, offset, limit int) /* Pasamos el Search Params */ ([]domain.User, error) {
+func (s service) GetAll(ctx context.Context, filters Filters, sort []SortField, fields []string, offset, limit int) /* Pasamos el Search Params */ ([]User, error) {
 
 	/* Traemos a los Users y usamos nos traemos el .GetAll() de la Interface del Service (s.repo), que previamente declaramos en nuestro Repository (GetAll) */
-	users, err := s.repo.GetAll(ctx, filters, offset, limit) // Tambien le pasamos el Search Params Y el
+	users, err := s.repo.GetAll(ctx, filters.folded(), sort, fields, offset, limit) // Tambien le pasamos el Search Params Y el
 
 	// Handleo error
 	if err != nil {
@@ -82,8 +159,14 @@ func (s service) GetAll(ctx context.Context, filters Filters, offset, limit int)
 
 }
 
-func (s service) Get(ctx context.Context, id string) (*domain.User, error) {
-	user, err := s.repo.Get(ctx, id)
+/* Get All por cursor (keyset). El cursor nil arranca desde el primer registro */
+func (s service) GetAllAfter(ctx context.Context, filters Filters, cursor *Cursor, fields []string, limit int) ([]User, error) {
+	return s.repo.GetAllAfter(ctx, filters.folded(), cursor, fields, limit)
+}
+
+// Los fields son opcionales, con nil se traen todas las columnas
+func (s service) Get(ctx context.Context, id string, fields []string) (*User, error) {
+	user, err := s.repo.Get(ctx, id, fields)
 
 	// Handleo error
 	if err != nil {
@@ -94,15 +177,63 @@ func (s service) Get(ctx context.Context, id string) (*domain.User, error) {
 
 }
 
-func (s service) Delete(ctx context.Context, id string) error {
-	return s.repo.Delete(ctx, id)
+// La precondicion (If-Match) es opcional, con nil se borra sin chequear la version
+func (s service) Delete(ctx context.Context, id string, pre *Precondition) error {
+	return s.repo.Delete(ctx, id, pre)
+}
+
+// Borrado definitivo, tambien sirve para los que ya estaban borrados
+func (s service) Purge(ctx context.Context, id string, pre *Precondition) error {
+	return s.repo.Purge(ctx, id, pre)
 }
 
-func (s service) Update(ctx context.Context, id string, firstName *string, lastName *string, email *string, phone *string) (*domain.User, error) {
-	return s.repo.Update(ctx, id, firstName, lastName, email, phone)
+func (s service) Restore(ctx context.Context, id string) (*User, error) {
+	return s.repo.Restore(ctx, id)
+}
+
+func (s service) Update(ctx context.Context, id string, firstName *string, lastName *string, email *string, phone *string, pre *Precondition) (*User, error) {
+	email = normalizeEmailPtr(email)
+	return s.repo.Update(ctx, id, firstName, lastName, email, phone, pre)
+}
+
+// Reemplazo completo (PUT). Con upsert se crea el usuario si no existe
+func (s service) Replace(ctx context.Context, user *domain.User, upsert bool, pre *Precondition) (*User, bool, error) {
+	user.Email = NormalizeEmail(user.Email)
+	return s.repo.Replace(ctx, user, upsert, pre)
+}
+
+func (s service) UpdateMany(ctx context.Context, filters Filters, firstName *string, lastName *string, email *string, phone *string) (*BulkResult, error) {
+	email = normalizeEmailPtr(email)
+	return s.repo.UpdateMany(ctx, filters.folded(), firstName, lastName, email, phone)
+}
+
+func (s service) DeleteMany(ctx context.Context, filters Filters) (*BulkResult, error) {
+	return s.repo.DeleteMany(ctx, filters.folded())
+}
+
+// Export: le pasamos cada lote a fn sin cargar toda la tabla en memoria
+func (s service) Export(ctx context.Context, filters Filters, fn func(users []User) error) error {
+	return s.repo.Stream(ctx, filters.folded(), exportBatchSize, fn)
 }
 
 // Pasamos el Count en el Service
 func (s service) Count(ctx context.Context, filters Filters) (int, error) {
-	return s.repo.Count(ctx, filters)
+	return s.repo.Count(ctx, filters.folded())
+}
+
+func (s service) EmailsInUse(ctx context.Context, emails []string) (map[string]bool, error) {
+	normalized := make([]string, 0, len(emails))
+	for _, email := range emails {
+		normalized = append(normalized, NormalizeEmail(email))
+	}
+	return s.repo.EmailsInUse(ctx, normalized)
+}
+
+// En las modificaciones el email es opcional (nil si no vino)
+func normalizeEmailPtr(email *string) *string {
+	if email == nil {
+		return nil
+	}
+	normalized := NormalizeEmail(*email)
+	return &normalized
 }
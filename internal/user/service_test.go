@@ -0,0 +1,92 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/juanjoaquin/back-g-domain/domain"
+	"gorm.io/gorm"
+)
+
+// Repositorio falso para el alta masiva. Los metodos que no implementa entran en panic (Repository es nil)
+type createRepo struct {
+	Repository
+	batchErr  error
+	createErr map[string]error // Por email
+	batches   int
+	creates   int
+}
+
+func (r *createRepo) CreateBatch(_ context.Context, users []*domain.User) error {
+	r.batches++
+	return r.batchErr
+}
+
+func (r *createRepo) Create(_ context.Context, user *domain.User) error {
+	r.creates++
+	return r.createErr[user.Email]
+}
+
+func TestCreateMany(t *testing.T) {
+	duplicate := &StoreError{Kind: KindConflict, Err: gorm.ErrDuplicatedKey}
+	down := &StoreError{Kind: KindUnavailable, Err: errors.New("dial tcp: connection refused")}
+	timeout := &StoreError{Kind: KindTimeout, Err: errors.New("i/o timeout")}
+
+	tests := []struct {
+		name        string
+		users       int
+		batchErr    error
+		createErr   map[string]error
+		wantBatches int
+		wantCreates int
+		wantErrs    map[int]error // El resto sin error
+		allErr      error         // Todos con este error
+	}{
+		{name: "sin errores", users: 250, wantBatches: 3},
+		{
+			name:        "duplicado reintenta de a uno",
+			users:       3,
+			batchErr:    duplicate,
+			createErr:   map[string]error{"u1@mail.com": ErrEmailAlreadyExists{"u1@mail.com"}},
+			wantBatches: 1,
+			wantCreates: 3,
+			wantErrs:    map[int]error{1: ErrEmailAlreadyExists{"u1@mail.com"}},
+		},
+		{name: "DB caida no reintenta", users: 250, batchErr: down, wantBatches: 1, allErr: down},
+		{name: "timeout no reintenta", users: 250, batchErr: timeout, wantBatches: 1, allErr: timeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &createRepo{batchErr: tt.batchErr, createErr: tt.createErr}
+			s := NewService(log.New(io.Discard, "", 0), repo)
+
+			users := make([]*domain.User, tt.users)
+			for i := range users {
+				users[i] = &domain.User{FirstName: "U", LastName: "U", Email: fmt.Sprintf("U%d@mail.com", i)}
+			}
+
+			errs := s.CreateMany(context.Background(), users)
+
+			if repo.batches != tt.wantBatches || repo.creates != tt.wantCreates {
+				t.Errorf("batches = %d, creates = %d, want %d, %d", repo.batches, repo.creates, tt.wantBatches, tt.wantCreates)
+			}
+			if len(errs) != tt.users {
+				t.Fatalf("len(errs) = %d, want %d", len(errs), tt.users)
+			}
+			for i, err := range errs {
+				want := tt.wantErrs[i]
+				if tt.allErr != nil {
+					want = tt.allErr
+				}
+				if !errors.Is(err, want) {
+					t.Errorf("errs[%d] = %v, want %v", i, err, want)
+				}
+			}
+		})
+	}
+}
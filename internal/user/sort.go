@@ -0,0 +1,60 @@
+package user
+
+// Aqui parseamos el query param sort (ej: sort=last_name,-created_at).
+// Solo dejamos ordenar por las columnas de la whitelist, asi nunca llega al ORDER BY algo que mande el cliente.
+
+import (
+	"strings"
+)
+
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+// No es una columna: ordena por el puntaje de la busqueda libre (param q)
+const relevanceSort = "relevance"
+
+// Whitelist: nombre que manda el cliente => columna de la DB
+var sortableColumns = map[string]string{
+	"relevance":  relevanceSort,
+	"first_name": "first_name",
+	"last_name":  "last_name",
+	"email":      "email",
+	"phone":      "phone",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// El "-" adelante del campo indica orden descendente
+func ParseSort(s string) ([]SortField, error) {
+	var fields []SortField
+
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+
+		desc := strings.HasPrefix(f, "-")
+		name := strings.TrimPrefix(f, "-")
+
+		column, ok := sortableColumns[name]
+		if !ok {
+			return nil, ErrInvalidSortField{name}
+		}
+
+		fields = append(fields, SortField{Column: column, Desc: desc})
+	}
+
+	return fields, nil
+}
+
+func hasRelevanceSort(fields []SortField) bool {
+	for _, f := range fields {
+		if f.Column == relevanceSort {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package user
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []SortField
+		err   error
+	}{
+		{name: "vacio", input: "", want: nil},
+		{name: "solo comas", input: " , ,", want: nil},
+		{name: "ascendente", input: "last_name", want: []SortField{{Column: "last_name"}}},
+		{name: "descendente", input: "-created_at", want: []SortField{{Column: "created_at", Desc: true}}},
+		{
+			name:  "varios con espacios",
+			input: " last_name , -created_at,email ",
+			want:  []SortField{{Column: "last_name"}, {Column: "created_at", Desc: true}, {Column: "email"}},
+		},
+		{name: "relevancia", input: "relevance", want: []SortField{{Column: relevanceSort}}},
+		{name: "campo que no esta en la whitelist", input: "last_name,password", err: ErrInvalidSortField{"password"}},
+		{name: "descendente de un campo invalido", input: "-deleted", err: ErrInvalidSortField{"deleted"}},
+		{name: "sql", input: "id;drop table users", err: ErrInvalidSortField{"id;drop table users"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSort(tt.input)
+
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSort(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
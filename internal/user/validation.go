@@ -0,0 +1,169 @@
+package user
+
+// Validaciones de los datos del usuario. Juntamos todos los errores en un ValidationError
+// para que el cliente vea todos los campos con problemas en una sola respuesta.
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Largo maximo de cada columna (ver domain.User)
+const (
+	maxNameLength  = 50
+	maxEmailLength = 50
+	maxPhoneLength = 30
+)
+
+// Error de un campo con su codigo, asi el cliente lo puede identificar sin depender del texto
+type FieldError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Params  map[string]string `json:"-"` // Valores para armar el mensaje traducido (ej: max)
+}
+
+type ValidationError struct {
+	Fields map[string]error // Campo del JSON => primer error encontrado en ese campo
+}
+
+// Los mensajes van ordenados por campo, asi el texto no cambia entre requests
+func (e *ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	messages := make([]string, 0, len(names))
+	for _, name := range names {
+		messages = append(messages, e.Fields[name].Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Para que errors.Is(err, ErrFirstNameRequired) siga funcionando
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Fields))
+	for _, err := range e.Fields {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Codigo y mensaje de cada campo, es lo que va en el "errors" de la respuesta
+func (e *ValidationError) FieldErrors() map[string]FieldError {
+	fields := make(map[string]FieldError, len(e.Fields))
+	for name, err := range e.Fields {
+		fields[name] = FieldError{
+			Code:    ErrorCode(err, http.StatusBadRequest),
+			Message: err.Error(),
+			Params:  errorParams(err),
+		}
+	}
+	return fields
+}
+
+// El error del campo, si es el unico que fallo
+func (e *ValidationError) single() (error, bool) {
+	if len(e.Fields) != 1 {
+		return nil, false
+	}
+	for _, err := range e.Fields {
+		return err, true
+	}
+	return nil, false
+}
+
+// Nos quedamos con el primer error de cada campo (ej: si es requerido no tiene sentido validar el largo)
+func (e *ValidationError) add(field string, err error) {
+	if e.Fields == nil {
+		e.Fields = make(map[string]error)
+	}
+	if _, ok := e.Fields[field]; !ok {
+		e.Fields[field] = err
+	}
+}
+
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+type ErrFieldTooLong struct {
+	Field string
+	Max   int
+}
+
+func (e ErrFieldTooLong) Error() string {
+	return fmt.Sprintf("%s must have at most %d characters", e.Field, e.Max)
+}
+
+type ErrInvalidFormat struct {
+	Field string
+}
+
+func (e ErrInvalidFormat) Error() string {
+	return fmt.Sprintf("%s has an invalid format", e.Field)
+}
+
+// Validaciones del alta. Las comparten el Create, el alta masiva, el import y el PUT.
+// phoneRegion es el pais que se asume para los telefonos sin codigo de pais
+func validateCreateReq(req CreateReq, phoneRegion string) error {
+	return validateUpdateReq(&req.FirstName, &req.LastName, &req.Email, &req.Phone, phoneRegion)
+}
+
+// En la modificacion los campos son opcionales (nil), pero si vienen se validan igual que en el alta
+func validateUpdateReq(firstName, lastName, email, phone *string, phoneRegion string) error {
+	var v ValidationError
+
+	if firstName != nil {
+		validateName(&v, "first_name", *firstName, ErrFirstNameRequired)
+	}
+
+	if lastName != nil {
+		validateName(&v, "last_name", *lastName, ErrLastNameRequired)
+	}
+
+	if email != nil && NormalizeEmail(*email) != "" {
+		normalized := NormalizeEmail(*email)
+		if utf8.RuneCountInString(normalized) > maxEmailLength {
+			v.add("email", ErrFieldTooLong{"email", maxEmailLength})
+		}
+		if !validEmail(normalized) {
+			v.add("email", ErrInvalidFormat{"email"})
+		}
+	}
+
+	if phone != nil && *phone != "" {
+		if utf8.RuneCountInString(*phone) > maxPhoneLength {
+			v.add("phone", ErrFieldTooLong{"phone", maxPhoneLength})
+		}
+		if _, err := NormalizePhone(*phone, phoneRegion); err != nil {
+			v.add("phone", ErrInvalidFormat{"phone"})
+		}
+	}
+
+	return v.err()
+}
+
+func validateName(v *ValidationError, field, value string, required error) {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, required)
+		return
+	}
+	if utf8.RuneCountInString(value) > maxNameLength {
+		v.add(field, ErrFieldTooLong{field, maxNameLength})
+	}
+}
+
+// Sintaxis del RFC 5322 (net/mail), pero solo la direccion: sin nombre ("Juan <juan@mail.com>") ni comentarios
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
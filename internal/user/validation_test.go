@@ -0,0 +1,98 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateUpdateReq(t *testing.T) {
+	long := strings.Repeat("a", maxNameLength+1)
+
+	tests := []struct {
+		name                              string
+		firstName, lastName, email, phone *string
+		want                              map[string]string // Campo => codigo, nil si es valido
+	}{
+		{name: "sin campos", want: nil},
+		{name: "todo valido", firstName: str("Juan"), lastName: str("Perez"), email: str("juan@mail.com"), phone: str("011 4444-5555"), want: nil},
+		{name: "nombre con el largo maximo", firstName: str(strings.Repeat("ñ", maxNameLength)), want: nil},
+		{name: "email y telefono vacios son opcionales", email: str(""), phone: str(""), want: nil},
+		{name: "nombre vacio", firstName: str(""), want: map[string]string{"first_name": "first-name-required"}},
+		{name: "nombre con espacios", firstName: str("   "), want: map[string]string{"first_name": "first-name-required"}},
+		{name: "apellido muy largo", lastName: str(long), want: map[string]string{"last_name": "field-too-long"}},
+		{
+			name:      "junta todos los errores",
+			firstName: str(""),
+			lastName:  str(""),
+			email:     str("no-es-un-email"),
+			phone:     str("12"),
+			want: map[string]string{
+				"first_name": "first-name-required",
+				"last_name":  "last-name-required",
+				"email":      "invalid-format",
+				"phone":      "invalid-format",
+			},
+		},
+		{
+			name:  "un solo error por campo",
+			phone: str(strings.Repeat("1", maxPhoneLength+1)),
+			want:  map[string]string{"phone": "field-too-long"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUpdateReq(tt.firstName, tt.lastName, tt.email, tt.phone, "AR")
+
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				return
+			}
+
+			var v *ValidationError
+			if !errors.As(err, &v) {
+				t.Fatalf("err = %v, want a ValidationError", err)
+			}
+
+			got := make(map[string]string)
+			for name, field := range v.FieldErrors() {
+				got[name] = field.Code
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("field codes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Si falla un solo campo el error toma su codigo y sus params, con varios es validation-failed
+func TestValidationErrorCode(t *testing.T) {
+	single := validateUpdateReq(nil, str(strings.Repeat("a", maxNameLength+1)), nil, nil, "AR")
+	if code := ErrorCode(single, http.StatusBadRequest); code != "field-too-long" {
+		t.Errorf("single field code = %q, want field-too-long", code)
+	}
+	if params := errorParams(single); params["max"] == "" {
+		t.Errorf("single field params = %v, want max", params)
+	}
+	if !errors.Is(validateUpdateReq(str(""), nil, nil, nil, "AR"), ErrFirstNameRequired) {
+		t.Errorf("errors.Is(err, ErrFirstNameRequired) = false")
+	}
+
+	multiple := validateUpdateReq(str(""), str(""), nil, nil, "AR")
+	if code := ErrorCode(multiple, http.StatusBadRequest); code != "validation-failed" {
+		t.Errorf("multiple fields code = %q, want validation-failed", code)
+	}
+	if msg := multiple.Error(); msg != ErrFirstNameRequired.Error()+"; "+ErrLastNameRequired.Error() {
+		t.Errorf("message = %q, want the field messages sorted by field", msg)
+	}
+
+	resp := NewErrorResponse(multiple, http.StatusBadRequest).(*ErrorResponse)
+	if len(resp.Fields) != 2 || resp.Fields["last_name"].Code != "last-name-required" {
+		t.Errorf("response fields = %+v", resp.Fields)
+	}
+}